@@ -0,0 +1,99 @@
+package consul
+
+import (
+	"sort"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// AgentClient is the part of Consul agent API which is available through the client.
+// It is implemented by *consulapi.Agent.
+type AgentClient interface {
+	Self() (map[string]map[string]interface{}, error)
+	NodeName() (string, error)
+	ServiceRegister(service *consulapi.AgentServiceRegistration) error
+	ServiceDeregister(serviceID string) error
+	Checks() (map[string]*consulapi.AgentCheck, error)
+}
+
+// Agent returns client of the local Consul agent, or nil if KV is set with SetKV.
+// Services registered directly through it are not deregistered by Stop, use ServiceRegister for it.
+func (c *Client) Agent() AgentClient {
+	return c.agent
+}
+
+// ConsulClient returns the underlying Consul client, or nil if KV is set with SetKV.
+func (c *Client) ConsulClient() *consulapi.Client {
+	return c.consul
+}
+
+// ServiceRegister registers svc in the local Consul agent.
+// Services registered through the client are deregistered by Stop.
+// It returns ErrNotSupported if KV is set with SetKV.
+func (c *Client) ServiceRegister(svc *consulapi.AgentServiceRegistration) error {
+	if c.agent == nil {
+		return ErrNotSupported
+	}
+	if err := c.agent.ServiceRegister(svc); err != nil {
+		return errors.Wrapf(err, "register service '%s'", svc.Name)
+	}
+	id := svc.ID
+	if id == "" {
+		// Consul uses service name as ID when it is not set.
+		id = svc.Name
+	}
+	c.services.lock.Lock()
+	c.services.ids[id] = true
+	c.services.lock.Unlock()
+	return nil
+}
+
+// ServiceDeregister deregisters service from the local Consul agent.
+func (c *Client) ServiceDeregister(serviceID string) error {
+	if c.agent == nil {
+		return ErrNotSupported
+	}
+	if err := c.agent.ServiceDeregister(serviceID); err != nil {
+		return errors.Wrapf(err, "deregister service '%s'", serviceID)
+	}
+	c.services.lock.Lock()
+	delete(c.services.ids, serviceID)
+	c.services.lock.Unlock()
+	return nil
+}
+
+// ServiceHealthChecks returns checks of service from the local Consul agent sorted by their IDs.
+func (c *Client) ServiceHealthChecks(serviceID string) ([]*consulapi.AgentCheck, error) {
+	if c.agent == nil {
+		return nil, ErrNotSupported
+	}
+	checks, err := c.agent.Checks()
+	if err != nil {
+		return nil, errors.Wrapf(err, "get checks of service '%s'", serviceID)
+	}
+	var serviceChecks []*consulapi.AgentCheck
+	for _, check := range checks {
+		if check.ServiceID == serviceID {
+			serviceChecks = append(serviceChecks, check)
+		}
+	}
+	sort.Slice(serviceChecks, func(i, j int) bool {
+		return serviceChecks[i].CheckID < serviceChecks[j].CheckID
+	})
+	return serviceChecks, nil
+}
+
+// deregisterServices deregisters all services registered through the client.
+// Errors are logged, as the client is stopped anyway.
+func (c *Client) deregisterServices() {
+	c.services.lock.Lock()
+	ids := c.services.ids
+	c.services.ids = map[string]bool{}
+	c.services.lock.Unlock()
+	for id := range ids {
+		if err := c.agent.ServiceDeregister(id); err != nil {
+			c.log(levelError, "service", id, "error", errors.Wrap(err, "deregister service"))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+type testAgent struct {
+	services map[string]*consulapi.AgentServiceRegistration
+	checks   map[string]*consulapi.AgentCheck
+}
+
+func (a *testAgent) Self() (map[string]map[string]interface{}, error) {
+	return map[string]map[string]interface{}{"Config": {"NodeName": "node-1"}}, nil
+}
+
+func (a *testAgent) NodeName() (string, error) {
+	return "node-1", nil
+}
+
+func (a *testAgent) ServiceRegister(service *consulapi.AgentServiceRegistration) error {
+	a.services[service.ID] = service
+	return nil
+}
+
+func (a *testAgent) ServiceDeregister(serviceID string) error {
+	delete(a.services, serviceID)
+	return nil
+}
+
+func (a *testAgent) Checks() (map[string]*consulapi.AgentCheck, error) {
+	return a.checks, nil
+}
+
+func TestClient_ServiceRegister(t *testing.T) {
+	agent := &testAgent{
+		services: map[string]*consulapi.AgentServiceRegistration{},
+		checks: map[string]*consulapi.AgentCheck{
+			"api-http":   {CheckID: "api-http", ServiceID: "api-1"},
+			"api-grpc":   {CheckID: "api-grpc", ServiceID: "api-1"},
+			"worker-tcp": {CheckID: "worker-tcp", ServiceID: "worker-1"},
+		},
+	}
+	c := newTestClient(t, testKV{})
+	c.agent = agent
+	api := &consulapi.AgentServiceRegistration{ID: "api-1", Name: "api", Port: 8080, Tags: []string{"v1"}}
+	for _, svc := range []*consulapi.AgentServiceRegistration{api, {ID: "worker-1", Name: "worker"}, {ID: "cron-1", Name: "cron"}} {
+		if err := c.ServiceRegister(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if agent.services["api-1"] != api {
+		t.Errorf("registration is not forwarded: %v", agent.services)
+	}
+	if err := c.ServiceDeregister("cron-1"); err != nil {
+		t.Fatal(err)
+	}
+	checks, err := c.ServiceHealthChecks("api-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 2 || checks[0].CheckID != "api-grpc" || checks[1].CheckID != "api-http" {
+		t.Errorf("got %v", checks)
+	}
+	// Services registered outside of the client are kept on Stop.
+	agent.services["external"] = &consulapi.AgentServiceRegistration{ID: "external"}
+	c.Stop()
+	var left []string
+	for id := range agent.services {
+		left = append(left, id)
+	}
+	sort.Strings(left)
+	if !reflect.DeepEqual(left, []string{"external"}) {
+		t.Errorf("services left after Stop: %v", left)
+	}
+
+	if err := newTestClient(t, testKV{}).ServiceRegister(api); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestClient_Agent(t *testing.T) {
+	s := newConsulServer(t)
+	c := s.client(t)
+	if c.Agent() == nil || c.ConsulClient() == nil {
+		t.Error("agent is not set")
+	}
+	// The fake server does not serve agent API, only the request is checked.
+	_, _ = c.Agent().NodeName()
+	if len(s.queries) != 1 || s.queries[0]["path"] != "/v1/agent/self" {
+		t.Errorf("got %v", s.queries)
+	}
+
+	c = newTestClient(t, testKV{})
+	if c.Agent() != nil || c.ConsulClient() != nil {
+		t.Error("agent is set with custom KV")
+	}
+}
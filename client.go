@@ -3,15 +3,20 @@ package consul
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"os"
 	"path"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/api/watch"
 	"github.com/pkg/errors"
 	"github.com/vetcher/go-case"
 )
@@ -19,6 +24,92 @@ import (
 type KV interface {
 	Get(path string) ([]byte, error)
 	Put(path string, value []byte) error
+	Delete(path string) error
+	DeleteTree(prefix string) error
+	Keys(prefix string) ([]string, error)
+	// CAS writes value only if the key's modify index equals index.
+	// Index 0 means that the key must not exist.
+	CAS(path string, value []byte, index uint64) (bool, error)
+}
+
+// ContextKV is a KV which is able to propagate deadlines and cancellation.
+// When KV does not implement it, context is checked before each call.
+type ContextKV interface {
+	KV
+	GetWithContext(ctx context.Context, path string) ([]byte, error)
+	PutWithContext(ctx context.Context, path string, value []byte) error
+}
+
+var ErrRequiredKeyMissing = errors.New("required key is missing")
+
+// PairKV is a KV which returns values together with their metadata.
+type PairKV interface {
+	KV
+	GetPair(ctx context.Context, path string) ([]byte, KVMeta, error)
+}
+
+// IndexedKV is a KV which supports blocking queries.
+// When KV implements it, watched values are refreshed as soon as they change,
+// otherwise they are polled every refresh period.
+type IndexedKV interface {
+	KV
+	// GetWithIndex blocks until the modify index of the key is greater than waitIndex
+	// or the wait time is over, and returns the value with the current index.
+	GetWithIndex(ctx context.Context, path string, waitIndex uint64) ([]byte, uint64, error)
+}
+
+// KVMeta is metadata of a key.
+type KVMeta struct {
+	Flags       uint64
+	ModifyIndex uint64
+	CreateIndex uint64
+	// Session holds the key, if it is locked.
+	Session string
+}
+
+// MetaKV is a KV which is able to return metadata of keys.
+type MetaKV interface {
+	KV
+	// GetMeta returns zero KVMeta for absent keys.
+	GetMeta(path string) (KVMeta, error)
+}
+
+var ErrNotSupported = errors.New("not supported by KV")
+
+// forwardingKV is a middleware which has methods of all optional interfaces,
+// but supports only some of them, usually the ones of the KV it wraps.
+type forwardingKV interface {
+	supportsKV(t reflect.Type) bool
+}
+
+// supportsKV reports whether kv supports optional interface t.
+func supportsKV(kv KV, t reflect.Type) bool {
+	if !reflect.TypeOf(kv).Implements(t) {
+		return false
+	}
+	if f, ok := kv.(forwardingKV); ok {
+		return f.supportsKV(t)
+	}
+	return true
+}
+
+// asKV sets target, which is a pointer to an optional interface like IndexedKV, to kv
+// and returns true if kv supports the interface, like errors.As does for errors.
+// Middlewares made with NewHookedKV support the interfaces of the KV they wrap.
+func asKV(kv KV, target interface{}) bool {
+	if !supportsKV(kv, reflect.TypeOf(target).Elem()) {
+		return false
+	}
+	reflect.ValueOf(target).Elem().Set(reflect.ValueOf(kv))
+	return true
+}
+
+// IndexedTreeKV is a KV which supports blocking queries on prefixes.
+type IndexedTreeKV interface {
+	KV
+	// WaitTree blocks until any key under prefix is changed after waitIndex
+	// or the wait time is over, and returns the current index.
+	WaitTree(ctx context.Context, prefix string, waitIndex uint64) (uint64, error)
 }
 
 type Updatable interface {
@@ -29,49 +120,230 @@ type options struct {
 	onlyPull      bool
 	disableListen bool
 	refreshPeriod time.Duration
+	waitTime      time.Duration
 	kv            KV
 	normalizer    func(string) string
+	jsonNames     bool
 	logger        Logger
+	errorHandler  func(path string, err error)
+	consulConfig  *consulapi.Config
+	datacenter    string
+	token         string
+	tls           *consulapi.TLSConfig
+	// insecureSkipVerify disables verification of Consul certificate.
+	insecureSkipVerify bool
+	maxRetries         int
+	retryBackoff       time.Duration
+	// pathNormalizers are used instead of normalizer under their prefixes.
+	pathNormalizers map[string]func(string) string
+	// kvMiddlewares wrap KV in the order they were added.
+	kvMiddlewares []func(KV) KV
+	watchHooks    []func(path string, err error)
+	loadHooks     []func(ctx context.Context, path string) (context.Context, func(error))
+	sessionID     string
+	watchJitter   time.Duration
+	groupName     string
+	namespace     string
+	partition     string
+	// errorsSize is the buffer size of WatchErrors channel.
+	errorsSize int
+	// logLevel is the name of the minimal level of logged records, error by default.
+	logLevel string
 }
 
 type Client struct {
-	kv   KV
-	stop func()
-	ctx  context.Context
-	opts options
+	kv       KV
+	stop     func()
+	ctx      context.Context
+	opts     options
+	logLevel logLevel
 
 	watch struct {
-		list []watchItem
+		list   []*watchItem
+		groups []*watchGroupItem
+		lock   sync.Mutex
+		// added wakes up runWatch to reschedule refreshes when an item is added.
+		added  chan struct{}
+		errors chan WatchError
+	}
+
+	// consul, agent and events are nil when KV is set with SetKV.
+	consul   *consulapi.Client
+	agent    AgentClient
+	events   eventClient
+	services struct {
+		ids  map[string]bool
+		lock sync.Mutex
+	}
+	plans struct {
+		list []*watch.Plan
+		lock sync.Mutex
+	}
+	migrations struct {
+		list []migration
 		lock sync.Mutex
 	}
 }
 
 func NewClient(opts ...Option) (*Client, error) {
+	o := options{
+		refreshPeriod: time.Minute,
+		normalizer:    go_case.ToDotSnakeCase,
+		errorsSize:    100,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if _, ok := parseLogLevel(o.logLevel); !ok {
+		return nil, errors.Errorf("invalid log level '%s'", o.logLevel)
+	}
+	var c *consulapi.Client
+	if o.kv == nil {
+		cfg := o.consulConfig
+		if cfg == nil {
+			cfg = consulapi.DefaultConfig()
+		}
+		var err error
+		if c, err = consulapi.NewClient(o.overrideConfig(cfg)); err != nil {
+			return nil, err
+		}
+	}
+	return newClient(o, c), nil
+}
+
+// newClient creates client with opts, which uses Consul client c unless KV is set with SetKV.
+func newClient(opts options, c *consulapi.Client) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	cl := &Client{
 		stop: cancel,
 		ctx:  ctx,
-		opts: options{
-			refreshPeriod: time.Minute,
-			normalizer:    go_case.ToDotSnakeCase,
-		},
-	}
-	for _, opt := range opts {
-		opt(&cl.opts)
+		opts: opts,
 	}
+	cl.logLevel, _ = parseLogLevel(opts.logLevel)
+	cl.watch.added = make(chan struct{}, 1)
+	cl.watch.errors = make(chan WatchError, cl.opts.errorsSize)
+	cl.services.ids = map[string]bool{}
 	if cl.opts.kv == nil {
-		c, err := consulapi.NewClient(consulapi.DefaultConfig())
-		if err != nil {
-			return nil, err
+		cl.kv = consulKV{
+			kv:         c.KV(),
+			txn:        c.Txn(),
+			session:    c.Session(),
+			waitTime:   cl.opts.waitTime,
+			datacenter: cl.opts.datacenter,
+			namespace:  cl.opts.namespace,
+			partition:  cl.opts.partition,
+			retries:    cl.opts.maxRetries,
+			backoff:    cl.opts.retryBackoff,
+			sessionID:  cl.opts.sessionID,
+			onRetry: func(attempt int, err error) {
+				cl.log(levelWarn, "op", "retry", "attempt", attempt, "error", err)
+			},
 		}
-		cl.kv = consulKV{kv: c.KV()}
+		cl.consul = c
+		cl.agent = c.Agent()
+		cl.events = c.Event()
 	} else {
 		cl.kv = cl.opts.kv
 	}
+	for _, mw := range cl.opts.kvMiddlewares {
+		cl.kv = mw(cl.kv)
+	}
 	if !cl.opts.disableListen {
 		go cl.runWatch()
 	}
-	return cl, nil
+	return cl
+}
+
+// Partition returns client which shares connection and options with c,
+// but reads and writes KV of Consul admin partition name. Empty name means the default partition.
+// Admin partitions are supported by Consul Enterprise only.
+// The returned client has its own watched values, so it should be stopped separately.
+// Partition is ignored when KV is set with SetKV.
+func (c *Client) Partition(name string) *Client {
+	opts := c.opts
+	opts.partition = name
+	return newClient(opts, c.consul)
+}
+
+// NewClientFromEnv creates client configured from environment variables:
+//
+//	CONSUL_HTTP_ADDR       - address of Consul agent, may have http:// or https:// scheme
+//	CONSUL_HTTP_TOKEN      - ACL token
+//	CONSUL_HTTP_SSL        - use https if true
+//	CONSUL_TLS_SERVER_NAME - server name to verify TLS certificate
+//	CONSUL_HTTP_SSL_VERIFY - verify TLS certificate, true by default
+//	CONSUL_REFRESH_PERIOD  - refresh period of watched values, e.g. 30s
+//
+// opts are applied after options from environment.
+func NewClientFromEnv(opts ...Option) (*Client, error) {
+	envOpts, err := optionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(append(envOpts, opts...)...)
+}
+
+func optionsFromEnv() ([]Option, error) {
+	cfg := consulapi.DefaultConfig()
+	if addr := os.Getenv("CONSUL_HTTP_ADDR"); addr != "" {
+		if parts := strings.SplitN(addr, "://", 2); len(parts) == 2 {
+			cfg.Scheme, addr = parts[0], parts[1]
+		}
+		cfg.Address = addr
+	}
+	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+	if v := os.Getenv("CONSUL_HTTP_SSL"); v != "" {
+		ssl, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse CONSUL_HTTP_SSL")
+		}
+		if ssl {
+			cfg.Scheme = "https"
+		}
+	}
+	if name := os.Getenv("CONSUL_TLS_SERVER_NAME"); name != "" {
+		cfg.TLSConfig.Address = name
+	}
+	if v := os.Getenv("CONSUL_HTTP_SSL_VERIFY"); v != "" {
+		verify, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse CONSUL_HTTP_SSL_VERIFY")
+		}
+		cfg.TLSConfig.InsecureSkipVerify = !verify
+	}
+	opts := []Option{WithConsulConfig(cfg)}
+	if v := os.Getenv("CONSUL_REFRESH_PERIOD"); v != "" {
+		period, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse CONSUL_REFRESH_PERIOD")
+		}
+		opts = append(opts, RefreshPeriod(period))
+	}
+	return opts, nil
+}
+
+// overrideConfig returns copy of cfg with settings from options.
+func (o options) overrideConfig(cfg *consulapi.Config) *consulapi.Config {
+	overridden := *cfg
+	if o.token != "" {
+		overridden.Token = o.token
+	}
+	if o.datacenter != "" {
+		// KV calls set datacenter themselves, but watch plans use the client default.
+		overridden.Datacenter = o.datacenter
+	}
+	if o.tls != nil {
+		overridden.Scheme = "https"
+		overridden.TLSConfig.CertFile = o.tls.CertFile
+		overridden.TLSConfig.KeyFile = o.tls.KeyFile
+		overridden.TLSConfig.CAFile = o.tls.CAFile
+	}
+	if o.insecureSkipVerify {
+		overridden.TLSConfig.InsecureSkipVerify = true
+	}
+	return &overridden
 }
 
 func Must(client *Client, err error) *Client {
@@ -82,120 +354,932 @@ func Must(client *Client, err error) *Client {
 }
 
 func (c *Client) PullOrPush(path string, out interface{}) error {
+	return c.PullOrPushWithContext(context.Background(), path, out)
+}
+
+// MustPullOrPush calls PullOrPush and panics on error.
+func (c *Client) MustPullOrPush(path string, out interface{}) {
+	if err := c.PullOrPush(path, out); err != nil {
+		panic(errors.Wrapf(err, "pull or push '%s'", path))
+	}
+}
+
+func (c *Client) PullOrPushWithContext(ctx context.Context, path string, out interface{}) error {
+	mode := modePullOrPush
+	if c.opts.onlyPull {
+		mode = modeOnlyPull
+	}
+	return c.load(ctx, mode, path, out)
+}
+
+// GroupName returns parent under the group folder: GROUP_NAME environment variable
+// or name set with SetGroupName, the variable overrides the option.
+// Paths are not prefixed implicitly, so pass the result to PullOrPush to load values from the group folder.
+func (c *Client) GroupName(parent string) string {
+	group := c.opts.groupName
+	if env := os.Getenv("GROUP_NAME"); env != "" {
+		group = env
+	}
+	if group == "" {
+		return parent
+	}
+	return path.Join(group, parent)
+}
+
+// PullOrPushPartial loads only fields of out with the given Go names, like PullOrPush loads all of them.
+// Other fields are neither read nor written. Names of nested fields are not supported,
+// the whole nested structure is loaded by its name. Empty fields loads all fields.
+func (c *Client) PullOrPushPartial(path string, out interface{}, fields ...string) error {
+	if len(fields) == 0 {
+		return c.PullOrPush(path, out)
+	}
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("out is not a pointer to structure")
+	}
+	v = v.Elem()
+	mode := modePullOrPush
+	if c.opts.onlyPull {
+		mode = modeOnlyPull
+	}
+	for _, name := range fields {
+		fieldType, ok := v.Type().FieldByName(name)
+		if !ok || len(fieldType.Index) != 1 {
+			return errors.Errorf("field %s is not found", name)
+		}
+		if makeTagOpts(fieldType.Tag.Get("consul")).Skip {
+			continue
+		}
+		err := c.pullOrPush(context.Background(), mode, c.makeConsulPath(path, fieldType), v.Field(fieldType.Index[0]), &fieldType)
+		if err != nil {
+			return err
+		}
+	}
+	c.updateWatch()
+	return nil
+}
+
+// PullOrPushWithTimeout is like PullOrPushWithContext with context which is canceled after timeout.
+// KV calls are interrupted if KV implements ContextKV, otherwise the timeout is checked after each call.
+// It returns error caused by context.DeadlineExceeded if loading is not finished in time.
+func (c *Client) PullOrPushWithTimeout(path string, out interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+	return c.PullOrPushWithContext(ctx, path, out)
+}
+
+// modifyIndicesKey is a context key of map, where get collects modify indices of read keys.
+type modifyIndicesKey struct{}
+
+// PullOrPushWithIndex loads values like PullOrPush and returns modify indices of all read keys,
+// which may be used to check that values are not changed since loading, e.g. with CheckIndexOp.
+// Keys which were absent, including ones with pushed default values, are not returned.
+// It returns ErrNotSupported if KV does not implement PairKV.
+func (c *Client) PullOrPushWithIndex(path string, out interface{}) (map[string]uint64, error) {
+	var kv PairKV
+	if !asKV(c.kv, &kv) {
+		return nil, ErrNotSupported
+	}
+	mode := modePullOrPush
+	if c.opts.onlyPull {
+		mode = modeOnlyPull
+	}
+	indices := map[string]uint64{}
+	if err := c.load(context.WithValue(context.Background(), modifyIndicesKey{}, indices), mode, path, out); err != nil {
+		return nil, err
+	}
+	return indices, nil
+}
+
+// PullWithDefaults loads values like PullOrPush, but never writes to Consul:
+// absent keys are filled from default tags locally.
+func (c *Client) PullWithDefaults(path string, out interface{}) error {
+	return c.load(context.Background(), modePullWithDefaults, path, out)
+}
+
+// PullStrict loads values like PullWithDefaults, but fails with ErrRequiredKeyMissing
+// on the first absent key without default value, as if all fields were required.
+// It never writes to Consul.
+func (c *Client) PullStrict(path string, out interface{}) error {
+	return c.load(context.Background(), modeStrict, path, out)
+}
+
+// FillDefaults sets fields of i from their default tags without connecting to Consul.
+// Fields without default tag get zero values. Options opts are applied to the client, e.g. WithJSONTagFallback.
+func FillDefaults(i interface{}, opts ...Option) error {
+	c, err := newOfflineClient(opts...)
+	if err != nil {
+		return err
+	}
+	defer c.Stop()
+	return c.PullWithDefaults("", i)
+}
+
+// newOfflineClient returns client with opts, which works with in-memory KV and does not watch values,
+// for functions which do not connect to Consul.
+func newOfflineClient(opts ...Option) (*Client, error) {
+	return NewClient(append(append([]Option{SetKV(NewMemoryKV())}, opts...), DisableWatch)...)
+}
+
+func (c *Client) load(ctx context.Context, mode loadMode, path string, out interface{}) error {
 	v := reflect.ValueOf(out)
 	if !v.Elem().CanSet() {
 		return errors.New("out is not a pointer")
 	}
-	if err := c.pullOrPush(path, v.Elem(), nil); err != nil {
+	if err := c.pullOrPush(ctx, mode, path, v.Elem(), nil); err != nil {
+		return err
+	}
+	c.updateWatch()
+	return nil
+}
+
+func (c *Client) GetWithContext(ctx context.Context, path string) ([]byte, error) {
+	value, err := c.get(ctx, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get from '%s'", path)
+	}
+	return value, nil
+}
+
+func (c *Client) PutWithContext(ctx context.Context, path string, value []byte) error {
+	if err := c.put(ctx, path, value); err != nil {
+		return errors.Wrapf(err, "put to '%s'", path)
+	}
+	return nil
+}
+
+func (c *Client) Delete(path string) error {
+	if err := c.kv.Delete(path); err != nil {
+		return errors.Wrapf(err, "delete '%s'", path)
+	}
+	return nil
+}
+
+func (c *Client) DeleteTree(prefix string) error {
+	if err := c.kv.DeleteTree(prefix); err != nil {
+		return errors.Wrapf(err, "delete tree '%s'", prefix)
+	}
+	return nil
+}
+
+// GetMeta returns metadata of the key at path.
+// It returns ErrNotSupported if KV does not implement MetaKV.
+func (c *Client) GetMeta(path string) (KVMeta, error) {
+	var kv MetaKV
+	if !asKV(c.kv, &kv) {
+		return KVMeta{}, ErrNotSupported
+	}
+	meta, err := kv.GetMeta(path)
+	if err != nil {
+		return KVMeta{}, errors.Wrapf(err, "get meta from '%s'", path)
+	}
+	return meta, nil
+}
+
+// CASPut writes value only if nobody changed the key since modifyIndex.
+// It returns false when the write was rejected.
+func (c *Client) CASPut(path string, value []byte, modifyIndex uint64) (bool, error) {
+	ok, err := c.kv.CAS(path, value, modifyIndex)
+	if err != nil {
+		return false, errors.Wrapf(err, "cas to '%s'", path)
+	}
+	return ok, nil
+}
+
+func (c *Client) Keys(prefix string) ([]string, error) {
+	keys, err := c.kv.Keys(prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "keys from '%s'", prefix)
+	}
+	return keys, nil
+}
+
+// EnsurePrefix creates folder marker, an empty key prefix+"/", which is shown as a folder by Consul UI.
+// Existing marker is not written again, so it is safe to call EnsurePrefix several times.
+func (c *Client) EnsurePrefix(prefix string) error {
+	marker := strings.TrimSuffix(prefix, "/") + "/"
+	keys, err := c.kv.Keys(marker)
+	if err != nil {
+		return errors.Wrapf(err, "keys from '%s'", marker)
+	}
+	for _, key := range keys {
+		if key == marker {
+			return nil
+		}
+	}
+	// Marker is created only if it is absent, in case it is created concurrently.
+	if _, err := c.kv.CAS(marker, []byte{}, 0); err != nil {
+		return errors.Wrapf(err, "cas to '%s'", marker)
+	}
+	return nil
+}
+
+// DeleteFromStruct deletes keys of all fields of i under parent.
+// Nested structures are deleted field by field and maps are deleted with all their entries.
+func (c *Client) DeleteFromStruct(parent string, i interface{}) error {
+	t := reflect.TypeOf(i)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return errors.New("i is not a structure")
+	}
+	return c.deleteStruct(parent, t)
+}
+
+func (c *Client) deleteStruct(consulPath string, t reflect.Type) error {
+	for i, n := 0, t.NumField(); i < n; i++ {
+		fieldType := t.Field(i)
+		opts := makeTagOpts(fieldType.Tag.Get("consul"))
+		if fieldType.PkgPath != "" || opts.Skip {
+			continue
+		}
+		fieldPath := c.makeConsulPath(consulPath, fieldType)
+		ft := fieldType.Type
+		if _, ok := wellKnowTypeParsers[ft]; !ok && ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// Flatten values are stored in a single key.
+		_, wellKnown := wellKnowTypeParsers[ft]
+		wellKnown = wellKnown || opts.Flatten
+		switch {
+		case !wellKnown && ft.Kind() == reflect.Struct:
+			if err := c.deleteStruct(fieldPath, ft); err != nil {
+				return err
+			}
+		case !wellKnown && ft.Kind() == reflect.Map:
+			if err := c.DeleteTree(fieldPath + "/"); err != nil {
+				return err
+			}
+		default:
+			if err := c.Delete(fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Snapshot returns values of all keys under prefix by their full paths.
+func (c *Client) Snapshot(prefix string) (map[string]string, error) {
+	keys, err := c.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, err := c.kv.Get(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get from '%s'", key)
+		}
+		snapshot[key] = string(value)
+	}
+	return snapshot, nil
+}
+
+// Restore puts values from snapshot made by Snapshot.
+// All keys of data should be under prefix.
+func (c *Client) Restore(prefix string, data map[string]string) error {
+	for key := range data {
+		if !strings.HasPrefix(key, prefix) {
+			return errors.Errorf("key '%s' is not under prefix '%s'", key, prefix)
+		}
+	}
+	for key, value := range data {
+		if err := c.kv.Put(key, []byte(value)); err != nil {
+			return errors.Wrapf(err, "put to '%s'", key)
+		}
+	}
+	return nil
+}
+
+func (c *Client) Watch(path string, out Updatable) {
+	c.addWatch(&watchItem{path: path, target: out})
+}
+
+// RegisterWatchGroup applies current values of the group and refreshes it
+// every refresh period.
+func (c *Client) RegisterWatchGroup(wg *WatchGroup) error {
+	item := &watchGroupItem{group: wg}
+	c.watch.lock.Lock()
+	defer c.watch.lock.Unlock()
+	if err := c.updateWatchGroup(item); err != nil {
+		return err
+	}
+	c.watch.groups = append(c.watch.groups, item)
+	return nil
+}
+
+// WatchWithCallback watches path like Watch and calls fn with previous and
+// new raw values each time the value is changed and successfully updated.
+// fn is called while the watch lock is held, so it must not call
+// PullOrPush, Watch or other methods which register watches.
+func (c *Client) WatchWithCallback(path string, out Updatable, fn func(old, new []byte)) {
+	last, err := c.get(c.ctx, path)
+	if err != nil {
+		c.watchError(path, err)
+	}
+	c.addWatch(&watchItem{path: path, target: out, lastValue: last, onUpdate: fn})
+}
+
+// WatchMap loads values of all keys directly under prefix to out by their names
+// and refreshes them every period, or every refresh period if period is not positive.
+// Keys are listed on each refresh, so added and deleted keys are reflected too.
+func (c *Client) WatchMap(prefix string, out *MapValue, period time.Duration) error {
+	item := &watchItem{path: prefix, period: period}
+	item.refresh = func() error {
+		values, err := c.loadMap(c.ctx, prefix)
+		if err != nil {
+			return err
+		}
+		out.set(values)
+		return nil
+	}
+	if err := item.refresh(); err != nil {
+		return err
+	}
+	c.addWatch(item)
+	return nil
+}
+
+// loadMap returns values of keys directly under prefix by their names.
+func (c *Client) loadMap(ctx context.Context, prefix string) (map[string]string, error) {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	keys, err := c.keys(ctx, prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "keys from '%s'", prefix)
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		content, err := c.get(ctx, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get from '%s'", key)
+		}
+		values[name] = string(content)
+	}
+	return values, nil
+}
+
+type CustomParser func(path string, content []byte) (interface{}, error)
+
+var wellKnowTypeParsers = map[reflect.Type]CustomParser{}
+
+func RegisterWellKnownType(t reflect.Type, fn CustomParser) {
+	wellKnowTypeParsers[t] = fn
+}
+
+var reflectUpdatableInterface = reflect.TypeOf((*Updatable)(nil)).Elem()
+
+type loadMode int
+
+const (
+	// modePullOrPush pushes default values of absent keys.
+	modePullOrPush loadMode = iota
+	// modeOnlyPull neither uses nor pushes default values of absent keys.
+	modeOnlyPull
+	// modePullWithDefaults uses default values of absent keys without pushing them.
+	modePullWithDefaults
+	// modeDryRun only reads present keys and does not register watches.
+	modeDryRun
+	// modeStrict uses default values of absent keys without pushing them
+	// and fails on absent keys without default values.
+	modeStrict
+)
+
+func (m loadMode) defaults() bool {
+	return m == modePullOrPush || m == modePullWithDefaults || m == modeStrict
+}
+
+func (m loadMode) push() bool {
+	return m == modePullOrPush
+}
+
+func (c *Client) get(ctx context.Context, path string) (value []byte, err error) {
+	defer func(begin time.Time) { c.logOp("get", path, begin, len(value), err) }(time.Now())
+	if indices, ok := ctx.Value(modifyIndicesKey{}).(map[string]uint64); ok {
+		value, meta, err := c.kv.(PairKV).GetPair(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if meta.ModifyIndex != 0 {
+			indices[path] = meta.ModifyIndex
+		}
+		return value, nil
+	}
+	var kv ContextKV
+	if asKV(c.kv, &kv) {
+		return kv.GetWithContext(ctx, path)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	value, err = c.kv.Get(path)
+	if err == nil {
+		// KV can not be interrupted, so ctx is checked again after slow calls.
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (c *Client) keys(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.kv.Keys(prefix)
+}
+
+func (c *Client) put(ctx context.Context, path string, value []byte) (err error) {
+	defer func(begin time.Time) { c.logOp("put", path, begin, len(value), err) }(time.Now())
+	var kv ContextKV
+	if asKV(c.kv, &kv) {
+		return kv.PutWithContext(ctx, path, value)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.kv.Put(path, value)
+}
+
+func (c *Client) pullOrPush(ctx context.Context, mode loadMode, consulPath string, dst reflect.Value, structTag *reflect.StructField) (err error) {
+	if !dst.CanSet() {
+		return nil
+	}
+	var opts tagOpts
+	if structTag != nil {
+		opts = makeTagOpts(structTag.Tag.Get("consul"))
+		if len(opts.invalid) != 0 {
+			return errors.Errorf("field %s: %s", structTag.Name, strings.Join(opts.invalid, ", "))
+		}
+		if opts.DefaultEnv != nil {
+			if opts.Required {
+				return errors.Errorf("field %s: required and default_env options can not be used together", structTag.Name)
+			}
+			// Unset variable means no default, so Default is used if any.
+			if value := os.Getenv(*opts.DefaultEnv); value != "" {
+				opts.Default = &value
+			}
+		}
+	}
+	if opts.Sensitive {
+		defer func() { err = redactError(err, consulPath, dst.Type()) }()
+	}
+	if opts.Flatten {
+		return c.pullOrPushFlatten(ctx, mode, consulPath, dst, opts)
+	}
+	if _, ok := wellKnowTypeParsers[dst.Type()]; !ok && dst.Kind() == reflect.Ptr {
+		return c.pullOrPushPtr(ctx, mode, consulPath, dst, structTag)
+	}
+	if _, ok := wellKnowTypeParsers[dst.Type()]; !ok && dst.Kind() == reflect.Map {
+		return c.pullOrPushMap(ctx, mode, consulPath, dst, opts)
+	}
+	content, err := c.get(ctx, consulPath)
+	if err != nil {
+		return errors.Wrapf(err, "get from '%s'", consulPath)
+	}
+	if _, ok := wellKnowTypeParsers[dst.Type()]; ok || dst.Kind() != reflect.Struct {
+		if mode == modeDryRun && len(content) == 0 {
+			return nil
+		}
+		if opts.Required && opts.Default != nil {
+			return errors.Errorf("field %s: required and default options can not be used together", structTag.Name)
+		}
+		if (opts.Required || mode == modeStrict && opts.Default == nil) && len(content) == 0 {
+			return errors.Wrapf(ErrRequiredKeyMissing, "'%s'", consulPath)
+		}
+	}
+	if mode.defaults() && len(content) == 0 {
+		if _, ok := wellKnowTypeParsers[dst.Type()]; ok || dst.Kind() != reflect.Struct {
+			if opts.Default != nil {
+				content = []byte(*opts.Default)
+			}
+			if mode.push() && !opts.ReadOnly && !(opts.OmitEmpty && len(content) == 0) {
+				err := c.put(ctx, consulPath, content)
+				if err != nil {
+					return errors.Wrapf(err, "put to '%s'", consulPath)
+				}
+			}
+		}
+	}
+	if !c.opts.disableListen && mode != modeDryRun {
+		c.registerWatch(consulPath, dst, content, opts)
+	}
+	// Updatable values prepared by the caller are updated in place,
+	// so the parser does not drop their settings.
+	if dst.CanAddr() && !dst.IsZero() {
+		if u, ok := dst.Addr().Interface().(Updatable); ok {
+			if err := u.Update(content); err != nil {
+				return errors.Wrapf(err, "update %s value from path '%s'", dst.Type(), consulPath)
+			}
+			return nil
+		}
+	}
+	if fn, ok := formatParsers[dst.Type()]; ok && opts.Format != nil {
+		val, err := fn(*opts.Format, content)
+		if err != nil {
+			return errors.Wrapf(err, "parse %s value with format '%s' from path '%s'", dst.Type(), *opts.Format, consulPath)
+		}
+		dst.Set(reflect.ValueOf(val))
+		return nil
+	}
+	if fn, ok := wellKnowTypeParsers[dst.Type()]; ok {
+		val, err := fn(consulPath, content)
+		if err != nil {
+			return errors.Wrapf(err, "custom parser to %s value from path '%s'", dst.Type(), consulPath)
+		}
+		dst.Set(reflect.ValueOf(val))
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Struct:
+		return c.pullOrPushStruct(ctx, mode, consulPath, dst)
+	default:
+		val, err := c.defaultParser(dst, content, opts)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		dst.Set(reflect.ValueOf(val))
+		return nil
+	}
+}
+
+// loadingStructsKey is a context key of loadingStruct, the chain of structures which are being loaded.
+type loadingStructsKey struct{}
+
+type loadingStruct struct {
+	t      reflect.Type
+	parent *loadingStruct
+}
+
+// isLoadingStruct reports whether structure of type t is being loaded by one of the callers.
+func isLoadingStruct(ctx context.Context, t reflect.Type) bool {
+	for s, _ := ctx.Value(loadingStructsKey{}).(*loadingStruct); s != nil; s = s.parent {
+		if s.t == t {
+			return true
+		}
+	}
+	return false
+}
+
+// pullOrPushStruct loads all fields of dst within load hooks.
+func (c *Client) pullOrPushStruct(ctx context.Context, mode loadMode, consulPath string, dst reflect.Value) (err error) {
+	for i := range c.opts.loadHooks {
+		var done func(error)
+		ctx, done = c.opts.loadHooks[i](ctx, consulPath)
+		defer func() { done(err) }()
+	}
+	parent, _ := ctx.Value(loadingStructsKey{}).(*loadingStruct)
+	ctx = context.WithValue(ctx, loadingStructsKey{}, &loadingStruct{t: dst.Type(), parent: parent})
+	for i, n := 0, dst.NumField(); i < n; i++ {
+		field := dst.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		fieldType := dst.Type().Field(i)
+		if makeTagOpts(fieldType.Tag.Get("consul")).Skip {
+			continue
+		}
+		err := c.pullOrPush(ctx, mode, c.makeConsulPath(consulPath, fieldType), field, &fieldType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) pullOrPushPtr(ctx context.Context, mode loadMode, consulPath string, dst reflect.Value, structTag *reflect.StructField) error {
+	ptr := dst
+	if ptr.IsNil() {
+		// Nil pointers to structures which are being loaded are left nil,
+		// otherwise recursive types, like a list node, are allocated endlessly.
+		if isLoadingStruct(ctx, dst.Type().Elem()) {
+			return nil
+		}
+		ptr = reflect.New(dst.Type().Elem())
+	}
+	if !mode.defaults() && ptr.Elem().Kind() != reflect.Struct {
+		content, err := c.get(ctx, consulPath)
+		if err != nil {
+			return errors.Wrapf(err, "get from '%s'", consulPath)
+		}
+		if len(content) == 0 {
+			return nil
+		}
+	}
+	if err := c.pullOrPush(ctx, mode, consulPath, ptr.Elem(), structTag); err != nil {
 		return err
 	}
-	c.updateWatch()
+	dst.Set(ptr)
 	return nil
 }
 
-func (c *Client) Watch(path string, out Updatable) {
-	c.registerWatch(path, reflect.ValueOf(out))
-}
-
-type CustomParser func(path string, content []byte) (interface{}, error)
-
-var wellKnowTypeParsers = map[reflect.Type]CustomParser{}
-
-func RegisterWellKnownType(t reflect.Type, fn CustomParser) {
-	wellKnowTypeParsers[t] = fn
-}
-
-var reflectUpdatableInterface = reflect.TypeOf((*Updatable)(nil)).Elem()
-
-func (c *Client) pullOrPush(consulPath string, dst reflect.Value, structTag *reflect.StructField) error {
-	if !dst.CanSet() {
-		return nil
-	}
-	content, err := c.kv.Get(consulPath)
+// pullOrPushFlatten loads value of field with flatten tag option, which is stored as JSON in a single key.
+// When the key is absent, the default tag value or JSON of the current value is used.
+func (c *Client) pullOrPushFlatten(ctx context.Context, mode loadMode, consulPath string, dst reflect.Value, opts tagOpts) error {
+	content, err := c.get(ctx, consulPath)
 	if err != nil {
 		return errors.Wrapf(err, "get from '%s'", consulPath)
 	}
-	if !c.opts.onlyPull && len(content) == 0 {
-		if _, ok := wellKnowTypeParsers[dst.Type()]; ok || dst.Kind() != reflect.Struct {
-			if structTag != nil {
-				opts := makeTagOpts(structTag.Tag.Get("consul"))
-				if opts.Default != nil {
-					content = []byte(*opts.Default)
-				}
-			}
-			err := c.kv.Put(consulPath, content)
-			if err != nil {
+	if len(content) == 0 {
+		if opts.Required || mode == modeStrict && opts.Default == nil {
+			return errors.Wrapf(ErrRequiredKeyMissing, "'%s'", consulPath)
+		}
+		if !mode.defaults() {
+			return nil
+		}
+		if opts.Default != nil {
+			content = []byte(*opts.Default)
+		} else if content, err = json.Marshal(dst.Interface()); err != nil {
+			return errors.Wrapf(err, "marshal %s value for path '%s'", dst.Type(), consulPath)
+		}
+		if mode.push() && !opts.ReadOnly {
+			if err := c.put(ctx, consulPath, content); err != nil {
 				return errors.Wrapf(err, "put to '%s'", consulPath)
 			}
 		}
 	}
-	if !c.opts.disableListen {
-		c.registerWatch(consulPath, dst)
+	val := reflect.New(dst.Type())
+	if err := json.Unmarshal(content, val.Interface()); err != nil {
+		return errors.Wrapf(err, "unmarshal %s value from path '%s'", dst.Type(), consulPath)
 	}
-	if fn, ok := wellKnowTypeParsers[dst.Type()]; ok {
-		val, err := fn(consulPath, content)
+	dst.Set(val.Elem())
+	return nil
+}
+
+// pullOrPushMap loads map entries from keys right under consulPath.
+// Default tag value for maps is a list of key=value pairs.
+func (c *Client) pullOrPushMap(ctx context.Context, mode loadMode, consulPath string, dst reflect.Value, opts tagOpts) error {
+	if dst.Type().Key().Kind() != reflect.String {
+		return errors.Errorf("map[%s] is not supported", dst.Type().Key())
+	}
+	prefix := consulPath + "/"
+	keys, err := c.keys(ctx, prefix)
+	if err != nil {
+		return errors.Wrapf(err, "keys from '%s'", prefix)
+	}
+	entries := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		content, err := c.get(ctx, key)
 		if err != nil {
-			return errors.Wrapf(err, "custom parser to %s value from path '%s'", dst.Type(), consulPath)
+			return errors.Wrapf(err, "get from '%s'", key)
 		}
-		dst.Set(reflect.ValueOf(val))
-		return nil
+		entries[name] = content
 	}
-	switch dst.Kind() {
-	case reflect.Struct:
-		for i, n := 0, dst.NumField(); i < n; i++ {
-			field := dst.Field(i)
-			if !field.CanSet() {
+	if mode == modeStrict && len(entries) == 0 && opts.Default == nil {
+		return errors.Wrapf(ErrRequiredKeyMissing, "'%s'", prefix)
+	}
+	if mode.defaults() && len(entries) == 0 && opts.Default != nil {
+		for _, pair := range strings.Split(*opts.Default, opts.separator()) {
+			kv := strings.SplitN(pair, "=", 2)
+			name := strings.TrimSpace(kv[0])
+			if name == "" {
 				continue
 			}
-			fieldType := dst.Type().Field(i)
-			err := c.pullOrPush(c.makeConsulPath(consulPath, fieldType), field, &fieldType)
-			if err != nil {
-				return err
+			var content []byte
+			if len(kv) == 2 {
+				content = []byte(strings.TrimSpace(kv[1]))
+			}
+			if mode.push() && !opts.ReadOnly {
+				if err := c.put(ctx, prefix+name, content); err != nil {
+					return errors.Wrapf(err, "put to '%s'", prefix+name)
+				}
 			}
+			entries[name] = content
 		}
-	default:
-		val, err := c.defaultParser(dst, content)
-		if err != nil {
-			return err
+	}
+	elemType := dst.Type().Elem()
+	m := reflect.MakeMapWithSize(dst.Type(), len(entries))
+	for name, content := range entries {
+		var val interface{}
+		if elemType.Kind() == reflect.Interface && elemType.NumMethod() == 0 {
+			val = string(content)
+		} else {
+			val, err = c.defaultParser(reflect.New(elemType).Elem(), content, tagOpts{})
+			if err != nil {
+				return errors.Wrapf(err, "parse value from path '%s'", prefix+name)
+			}
 		}
-		dst.Set(reflect.ValueOf(val))
-		return nil
+		m.SetMapIndex(reflect.ValueOf(name).Convert(dst.Type().Key()), reflect.ValueOf(val).Convert(elemType))
 	}
+	dst.Set(m)
 	return nil
 }
 
-func (c *Client) registerWatch(consulPath string, dst reflect.Value) {
+func (c *Client) registerWatch(consulPath string, dst reflect.Value, content []byte, opts tagOpts) {
+	var period time.Duration
+	if opts.Period != nil {
+		period = *opts.Period
+	}
 	if dst.CanInterface() && dst.Type().Implements(reflectUpdatableInterface) {
-		c.watch.lock.Lock()
-		c.watch.list = append(c.watch.list, watchItem{path: consulPath, target: dst.Interface().(Updatable)})
-		c.watch.lock.Unlock()
+		c.addWatch(&watchItem{path: consulPath, target: dst.Interface().(Updatable), lastValue: content, period: period, sensitive: opts.Sensitive})
 	} else if dst.CanAddr() && dst.Addr().Type().Implements(reflectUpdatableInterface) {
-		c.watch.lock.Lock()
-		c.watch.list = append(c.watch.list, watchItem{path: consulPath, target: dst.Addr().Interface().(Updatable)})
-		c.watch.lock.Unlock()
+		c.addWatch(&watchItem{path: consulPath, target: dst.Addr().Interface().(Updatable), lastValue: content, period: period, sensitive: opts.Sensitive})
+	}
+}
+
+// addWatch registers item, if the same target is not watched on the same path yet.
+func (c *Client) addWatch(item *watchItem) {
+	c.watch.lock.Lock()
+	for _, existing := range c.watch.list {
+		if existing.path == item.path && existing.target == item.target && existing.refresh == nil && item.refresh == nil {
+			c.watch.lock.Unlock()
+			return
+		}
+	}
+	item.next = time.Now().Add(c.withJitter(c.period(item)))
+	item.ctx, item.cancel = context.WithCancel(c.ctx)
+	c.watch.list = append(c.watch.list, item)
+	c.watch.lock.Unlock()
+	var kv IndexedKV
+	if asKV(c.kv, &kv) && !c.opts.disableListen && item.refresh == nil {
+		go c.runBlockingWatch(kv, item)
+		return
+	}
+	select {
+	case c.watch.added <- struct{}{}:
+	default:
+	}
+}
+
+// RemoveWatch stops refreshing of all values watched on path, so they are not updated anymore.
+// Values watched under path, e.g. fields of a structure loaded from it, are not removed.
+func (c *Client) RemoveWatch(path string) {
+	c.watch.lock.Lock()
+	defer c.watch.lock.Unlock()
+	list := c.watch.list[:0]
+	for _, item := range c.watch.list {
+		if item.path == path {
+			item.cancel()
+			continue
+		}
+		list = append(list, item)
+	}
+	// Tail is cleared to release removed items.
+	for i := len(list); i < len(c.watch.list); i++ {
+		c.watch.list[i] = nil
+	}
+	c.watch.list = list
+}
+
+// ClearWatch stops refreshing of all watched values and groups.
+// Unlike Stop, the client may be used to watch new values after it.
+func (c *Client) ClearWatch() {
+	c.watch.lock.Lock()
+	defer c.watch.lock.Unlock()
+	for _, item := range c.watch.list {
+		item.cancel()
+	}
+	c.watch.list = nil
+	c.watch.groups = nil
+}
+
+// period returns refresh period of item, which is the client refresh period by default.
+func (c *Client) period(item *watchItem) time.Duration {
+	if item.period > 0 {
+		return item.period
+	}
+	return c.opts.refreshPeriod
+}
+
+// withJitter adds random duration in [0, watchJitter) to period,
+// so clients started at the same time do not refresh values at the same time.
+func (c *Client) withJitter(period time.Duration) time.Duration {
+	if c.opts.watchJitter <= 0 {
+		return period
 	}
+	return period + time.Duration(rand.Int63n(int64(c.opts.watchJitter)))
 }
 
+// makeConsulPath returns path of field under pref.
+// Name from tag may contain slashes, it is joined to pref as relative path,
+// so `consul:"name:db/host"` is placed at pref/db/host.
+// Fields of embedded structures and structures with inline tag are placed right under pref.
 func (c *Client) makeConsulPath(pref string, fieldType reflect.StructField) string {
 	tagOpts := makeTagOpts(fieldType.Tag.Get("consul"))
+	if tagOpts.Inline || fieldType.Anonymous && tagOpts.Name == nil && !tagOpts.Flatten {
+		if isPlainStruct(fieldType.Type) {
+			return pref
+		}
+	}
 	var kName string
-	if tagOpts.Name == nil {
-		kName = c.opts.normalizer(fieldType.Name)
-	} else {
+	if tagOpts.Name != nil {
 		kName = *tagOpts.Name
+	} else if name := jsonName(fieldType); c.opts.jsonNames && name != "" {
+		kName = name
+	} else {
+		kName = c.normalizer(pref)(fieldType.Name)
 	}
 	return path.Join(pref, kName)
 }
 
+// normalizer returns normalizer of the longest prefix of consulPath
+// set with WithPathNormalizer or the global normalizer.
+func (c *Client) normalizer(consulPath string) func(string) string {
+	fn, longest := c.opts.normalizer, -1
+	for prefix, prefixFn := range c.opts.pathNormalizers {
+		if len(prefix) > longest && (consulPath == prefix || strings.HasPrefix(consulPath, prefix+"/")) {
+			fn, longest = prefixFn, len(prefix)
+		}
+	}
+	return fn
+}
+
+// isPlainStruct reports whether t is a structure or pointer to it,
+// which is loaded field by field.
+func isPlainStruct(t reflect.Type) bool {
+	if _, ok := wellKnowTypeParsers[t]; !ok && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	_, ok := wellKnowTypeParsers[t]
+	return !ok && t.Kind() == reflect.Struct
+}
+
+func jsonName(fieldType reflect.StructField) string {
+	name := strings.SplitN(fieldType.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
 type tagOpts struct {
 	Name    *string
 	Default *string
+	// DefaultEnv is the name of environment variable with default value, which overrides Default.
+	DefaultEnv *string
+	Sep        *string
+	Format     *string
+	Required   bool
+	Skip       bool
+	ReadOnly   bool
+	OmitEmpty  bool
+	Inline     bool
+	Period     *time.Duration
+	Base       *int
+	Sensitive  bool
+	Flatten    bool
+	// unknown holds names of options which are not recognized.
+	unknown []string
+	// invalid holds descriptions of options with malformed values.
+	invalid []string
+}
+
+var underscoredNumber = regexp.MustCompile(`^[+-]?[0-9]+(_[0-9]+)+$`)
+
+// number returns integer value without base prefix and the base to parse it with.
+// Base 0 means that base is detected from the prefix, like in Go literals.
+// Decimal numbers may have underscores between digits, like Go literals.
+func (o tagOpts) number(value []byte) (string, int) {
+	if o.Base == nil {
+		if underscoredNumber.Match(value) {
+			return strings.Replace(string(value), "_", "", -1), 10
+		}
+		return string(value), 10
+	}
+	s, sign := string(value), ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		s, sign = s[1:], s[:1]
+	}
+	prefix := map[int]string{2: "0b", 8: "0o", 16: "0x"}[*o.Base]
+	if prefix != "" && len(s) > len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		s = s[len(prefix):]
+	}
+	return sign + s, *o.Base
+}
+
+// formatBase returns base to format integer values with.
+func (o tagOpts) formatBase() int {
+	if o.Base == nil || *o.Base == 0 {
+		return 10
+	}
+	return *o.Base
+}
+
+func (o tagOpts) separator() string {
+	if o.Sep == nil {
+		return ","
+	}
+	return *o.Sep
 }
 
 func makeTagOpts(scope string) tagOpts {
 	var tOpts tagOpts
 	opts := strings.Split(scope, ";")
-	for i := range opts {
+	for i := 0; i < len(opts); i++ {
 		kv := strings.SplitN(opts[i], ":", 2)
 		if len(kv) == 0 {
 			continue
@@ -207,19 +1291,88 @@ func makeTagOpts(scope string) tagOpts {
 			}
 			s := kv[1]
 			tOpts.Default = &s
+		case "default_env":
+			if len(kv) == 1 {
+				continue
+			}
+			s := kv[1]
+			tOpts.DefaultEnv = &s
 		case "name":
 			if len(kv) == 1 {
 				continue
 			}
 			s := kv[1]
 			tOpts.Name = &s
+		case "sep":
+			if len(kv) == 1 {
+				continue
+			}
+			s := kv[1]
+			// `sep:;` is split by the options delimiter itself,
+			// so an empty separator followed by an empty option means ';'.
+			if s == "" && i+1 < len(opts) && opts[i+1] == "" {
+				s = ";"
+				i++
+			}
+			if s == "" {
+				continue
+			}
+			tOpts.Sep = &s
+		case "format":
+			if len(kv) == 1 {
+				continue
+			}
+			s := kv[1]
+			tOpts.Format = &s
+		case "base":
+			if len(kv) == 1 {
+				continue
+			}
+			base, err := strconv.Atoi(kv[1])
+			if err != nil || base == 1 || base < 0 || base > 36 {
+				tOpts.invalid = append(tOpts.invalid, fmt.Sprintf("invalid base '%s'", kv[1]))
+				continue
+			}
+			tOpts.Base = &base
+		case "period":
+			if len(kv) == 1 {
+				continue
+			}
+			period, err := time.ParseDuration(kv[1])
+			if err != nil || period <= 0 {
+				tOpts.invalid = append(tOpts.invalid, fmt.Sprintf("invalid period '%s'", kv[1]))
+				continue
+			}
+			tOpts.Period = &period
+		case "skip", "-":
+			tOpts.Skip = true
+		case "readonly":
+			tOpts.ReadOnly = true
+		case "omitempty":
+			tOpts.OmitEmpty = true
+		case "inline":
+			tOpts.Inline = true
+		case "sensitive":
+			tOpts.Sensitive = true
+		case "flatten", "json":
+			// json is the same as flatten, it reads better for fields which are not structures.
+			tOpts.Flatten = true
+		case "required":
+			tOpts.Required = len(kv) == 1 || strings.ToLower(kv[1]) == "true"
+		case "":
+		default:
+			tOpts.unknown = append(tOpts.unknown, kv[0])
 		}
 	}
 	return tOpts
 }
 
-func (c *Client) defaultParser(t reflect.Value, value []byte) (interface{}, error) {
+// intSize is the size of int and uint in bits, it is a variable to test 32-bit platforms.
+var intSize = strconv.IntSize
+
+func (c *Client) defaultParser(t reflect.Value, value []byte, opts tagOpts) (interface{}, error) {
 	value = bytes.TrimSpace(value)
+	number, base := opts.number(value)
 	switch t.Kind() {
 	case reflect.String:
 		return string(value), nil
@@ -238,90 +1391,418 @@ func (c *Client) defaultParser(t reflect.Value, value []byte) (interface{}, erro
 		if len(value) == 0 {
 			return int(0), nil
 		}
-		n, err := strconv.ParseInt(string(value), 10, 64)
+		n, err := strconv.ParseInt(number, base, intSize)
 		return int(n), err
+	case reflect.Int8:
+		if len(value) == 0 {
+			return int8(0), nil
+		}
+		n, err := strconv.ParseInt(number, base, 8)
+		return int8(n), err
 	case reflect.Int16:
 		if len(value) == 0 {
 			return int16(0), nil
 		}
-		n, err := strconv.ParseInt(string(value), 10, 16)
+		n, err := strconv.ParseInt(number, base, 16)
 		return int16(n), err
 	case reflect.Int32:
 		if len(value) == 0 {
 			return int32(0), nil
 		}
-		n, err := strconv.ParseInt(string(value), 10, 32)
+		n, err := strconv.ParseInt(number, base, 32)
 		return int32(n), err
 	case reflect.Int64:
 		if len(value) == 0 {
 			return int64(0), nil
 		}
-		n, err := strconv.ParseInt(string(value), 10, 64)
+		n, err := strconv.ParseInt(number, base, 64)
 		return int64(n), err
 	case reflect.Uint:
 		if len(value) == 0 {
 			return uint(0), nil
 		}
-		n, err := strconv.ParseUint(string(value), 10, 64)
+		n, err := strconv.ParseUint(number, base, intSize)
 		return uint(n), err
+	case reflect.Uint8:
+		if len(value) == 0 {
+			return uint8(0), nil
+		}
+		n, err := strconv.ParseUint(number, base, 8)
+		return uint8(n), err
+	case reflect.Uint16:
+		if len(value) == 0 {
+			return uint16(0), nil
+		}
+		n, err := strconv.ParseUint(number, base, 16)
+		return uint16(n), err
 	case reflect.Uint32:
 		if len(value) == 0 {
 			return uint32(0), nil
 		}
-		n, err := strconv.ParseUint(string(value), 10, 32)
+		n, err := strconv.ParseUint(number, base, 32)
 		return uint32(n), err
 	case reflect.Uint64:
 		if len(value) == 0 {
-			return 0, nil
+			return uint64(0), nil
 		}
-		return strconv.ParseUint(string(value), 10, 64)
+		return strconv.ParseUint(number, base, 64)
 	case reflect.Bool:
 		return strconv.ParseBool(string(value))
 	case reflect.Slice:
-		if t.Elem().Kind() != reflect.Uint8 {
-			return nil, fmt.Errorf("[]%s is not supported", t.Elem().Kind())
+		if t.Type().Elem().Kind() == reflect.Uint8 {
+			return []byte(value), nil
 		}
-		return []byte(value), nil
+		return c.sliceParser(t, value, opts)
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return nil, errors.Errorf("can not find parser for %s", t.Type())
+		}
+		return interfaceParser(value), nil
 	default:
 		return nil, errors.Errorf("can not find parser for %s", t.Type())
 	}
 }
 
+// interfaceParser parses value of interface{} field as JSON.
+// Values which are not valid JSON are returned as strings, empty value is nil.
+func interfaceParser(value []byte) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return string(value)
+	}
+	return v
+}
+
+func (c *Client) sliceParser(t reflect.Value, value []byte, opts tagOpts) (interface{}, error) {
+	switch t.Type().Elem().Kind() {
+	case reflect.String, reflect.Int, reflect.Float64, reflect.Bool:
+	default:
+		return nil, fmt.Errorf("[]%s is not supported", t.Type().Elem().Kind())
+	}
+	if len(value) == 0 {
+		return reflect.MakeSlice(t.Type(), 0, 0).Interface(), nil
+	}
+	parts := strings.Split(string(value), opts.separator())
+	slice := reflect.MakeSlice(t.Type(), len(parts), len(parts))
+	for i := range parts {
+		elem := slice.Index(i)
+		val, err := c.defaultParser(elem, []byte(parts[i]), tagOpts{Base: opts.Base})
+		if err != nil {
+			return nil, errors.Wrapf(err, "element %d", i)
+		}
+		elem.Set(reflect.ValueOf(val).Convert(elem.Type()))
+	}
+	return slice.Interface(), nil
+}
+
+// Stop stops watching values and deregisters services registered with ServiceRegister.
 func (c *Client) Stop() {
 	c.stop()
+	c.stopPlans()
+	if c.agent != nil {
+		c.deregisterServices()
+	}
 }
 
+// runWatch refreshes watched values when their refresh periods are over
+// and watch groups every client refresh period.
+// When KV supports blocking queries, values are refreshed by their own loops,
+// so only watch groups and maps are refreshed here.
 func (c *Client) runWatch() {
-	timer := time.NewTimer(c.opts.refreshPeriod)
-	timer.Stop()
+	var indexed IndexedKV
+	blocking := asKV(c.kv, &indexed)
+	first := c.withJitter(c.opts.refreshPeriod)
+	nextGroups := time.Now().Add(first)
+	timer := time.NewTimer(first)
 	defer timer.Stop()
 	for {
-		timer.Reset(c.opts.refreshPeriod)
 		select {
 		case <-timer.C:
-			c.updateWatch()
+		case <-c.watch.added:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
 		case <-c.ctx.Done():
 			return
 		}
+		now := time.Now()
+		next := nextGroups
+		c.log(levelInfo, "op", "watch", "msg", "watch cycle started")
+		c.watch.lock.Lock()
+		next = c.updateDueWatch(now, next, blocking)
+		if !now.Before(nextGroups) {
+			c.updateWatchGroups()
+			nextGroups = now.Add(c.withJitter(c.opts.refreshPeriod))
+			if nextGroups.Before(next) {
+				next = nextGroups
+			}
+		}
+		c.watch.lock.Unlock()
+		c.log(levelInfo, "op", "watch", "msg", "watch cycle finished", "took", time.Since(now))
+		timer.Reset(next.Sub(now))
 	}
 }
 
-func (c *Client) updateWatch() {
-	c.watch.lock.Lock()
+// updateDueWatch refreshes items whose refresh time has come and returns the earliest
+// of next and the next refresh time of items. Items which are refreshed by blocking
+// queries are skipped when blocking is true. It should be called with watch lock held.
+func (c *Client) updateDueWatch(now, next time.Time, blocking bool) time.Time {
+	values := map[string][]byte{}
 	for _, item := range c.watch.list {
-		raw, err := c.kv.Get(item.path)
+		if blocking && item.refresh == nil {
+			continue
+		}
+		if !now.Before(item.next) {
+			item.next = now.Add(c.withJitter(c.period(item)))
+			c.refreshItem(item, values)
+		}
+		if item.next.Before(next) {
+			next = item.next
+		}
+	}
+	return next
+}
+
+// runBlockingWatch refreshes item each time its index is changed.
+// Period of item is used as wait time of its queries.
+// Errors are retried after the refresh period.
+func (c *Client) runBlockingWatch(kv IndexedKV, item *watchItem) {
+	ctx := item.ctx
+	if item.period > 0 {
+		ctx = context.WithValue(ctx, waitTimeKey{}, item.period)
+	}
+	var waitIndex uint64
+	for {
+		raw, index, err := kv.GetWithIndex(ctx, item.path, waitIndex)
+		if item.ctx.Err() != nil {
+			return
+		}
 		if err != nil {
-			_ = c.opts.logger.Log("path", item.path, "error", err)
+			c.watchError(item.path, err)
+			select {
+			case <-time.After(c.period(item)):
+				continue
+			case <-item.ctx.Done():
+				return
+			}
+		}
+		if index == waitIndex {
+			continue
+		}
+		// Index may go backwards after snapshot restore, so it should be reset.
+		if index < waitIndex {
+			waitIndex = 0
 			continue
 		}
-		if err := item.target.Update(raw); err != nil {
-			_ = c.opts.logger.Log("path", item.path, "error", err)
+		waitIndex = index
+		c.watch.lock.Lock()
+		// Item may be removed while its value was read.
+		if item.ctx.Err() == nil {
+			c.applyUpdate(item, raw)
 		}
+		c.watch.lock.Unlock()
+	}
+}
+
+func (c *Client) updateWatch() {
+	c.watch.lock.Lock()
+	values := map[string][]byte{}
+	for _, item := range c.watch.list {
+		c.refreshItem(item, values)
 	}
+	c.updateWatchGroups()
 	c.watch.lock.Unlock()
 }
 
+// refreshItem should be called with watch lock held.
+// values caches values read during one refresh cycle,
+// so a path watched by several targets is read once.
+func (c *Client) refreshItem(item *watchItem, values map[string][]byte) {
+	if item.refresh != nil {
+		if err := item.refresh(); err != nil {
+			c.watchError(item.path, err)
+		}
+		return
+	}
+	raw, ok := values[item.path]
+	if !ok {
+		var err error
+		if raw, err = c.get(c.ctx, item.path); err != nil {
+			c.watchError(item.path, err)
+			return
+		}
+		values[item.path] = raw
+	}
+	c.applyUpdate(item, raw)
+}
+
+// updateWatchGroups should be called with watch lock held.
+func (c *Client) updateWatchGroups() {
+	for _, group := range c.watch.groups {
+		if err := c.updateWatchGroup(group); err != nil {
+			c.watchError(strings.Join(group.group.Paths, ","), err)
+		}
+	}
+}
+
+// updateWatchGroup reads all paths of the group and applies them
+// if any value is changed since the last apply.
+func (c *Client) updateWatchGroup(item *watchGroupItem) error {
+	updates := make(map[string][]byte, len(item.group.Paths))
+	changed := item.last == nil
+	for _, p := range item.group.Paths {
+		raw, err := c.get(c.ctx, p)
+		if err != nil {
+			return errors.Wrapf(err, "get from '%s'", p)
+		}
+		updates[p] = raw
+		if old, ok := item.last[p]; !ok || !bytes.Equal(old, raw) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := item.group.Apply(updates); err != nil {
+		return err
+	}
+	item.last = updates
+	return nil
+}
+
+// applyUpdate should be called with watch lock held.
+func (c *Client) applyUpdate(item *watchItem, raw []byte) {
+	c.log(levelDebug, "op", "update", "path", item.path, "size", len(raw))
+	if err := item.target.Update(raw); err != nil {
+		if item.sensitive {
+			err = redactError(err, item.path, reflect.Indirect(reflect.ValueOf(item.target)).Type())
+		}
+		c.watchError(item.path, err)
+		return
+	}
+	c.watchUpdated(item.path, nil)
+	old := item.lastValue
+	item.lastValue = raw
+	if item.onUpdate != nil && !bytes.Equal(old, raw) {
+		item.onUpdate(old, raw)
+	}
+}
+
+// WatchError is an error of watched value refresh.
+type WatchError struct {
+	Path string
+	Err  error
+	At   time.Time
+}
+
+// WatchErrors returns channel of watched values refresh errors.
+// Errors are dropped when the channel buffer is full, its size is set with WithErrorChannelSize.
+func (c *Client) WatchErrors() <-chan WatchError {
+	return c.watch.errors
+}
+
+// watchError logs err and passes it to error handler and WatchErrors channel.
+func (c *Client) watchError(path string, err error) {
+	c.log(levelError, "path", path, "error", err)
+	if c.opts.errorHandler != nil {
+		c.opts.errorHandler(path, err)
+	}
+	select {
+	case c.watch.errors <- WatchError{Path: path, Err: err, At: time.Now()}:
+	default:
+		c.log(levelError, "path", path, "error", "watch errors channel is full, error is dropped")
+	}
+	c.watchUpdated(path, err)
+}
+
+// watchUpdated calls watch hooks with the result of watched value update.
+func (c *Client) watchUpdated(path string, err error) {
+	for _, hook := range c.opts.watchHooks {
+		hook(path, err)
+	}
+}
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = [...]string{levelDebug: "debug", levelInfo: "info", levelWarn: "warn", levelError: "error"}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+// parseLogLevel returns level by its name, empty name is error level.
+func parseLogLevel(name string) (logLevel, bool) {
+	if name == "" {
+		return levelError, true
+	}
+	for l, n := range logLevelNames {
+		if strings.EqualFold(n, name) {
+			return logLevel(l), true
+		}
+	}
+	return 0, false
+}
+
+// log logs keyvals with level if it is not below the level set with WithLogLevel.
+func (c *Client) log(level logLevel, keyvals ...interface{}) {
+	if c.opts.logger == nil || level < c.logLevel {
+		return
+	}
+	_ = c.opts.logger.Log(append([]interface{}{"level", level.String()}, keyvals...)...)
+}
+
+// logOp logs KV operation op: at debug level on success, and at error level on failure.
+// Values are not logged, as they may be secret, only their size is.
+func (c *Client) logOp(op, path string, begin time.Time, size int, err error) {
+	if err != nil {
+		c.log(levelError, "op", op, "path", path, "took", time.Since(begin), "error", err)
+		return
+	}
+	c.log(levelDebug, "op", op, "path", path, "took", time.Since(begin), "size", size)
+}
+
+// WatchGroup is a set of paths which are refreshed together:
+// values of all paths are read first and then passed to Apply at once,
+// so the caller never sees a part of the paths updated.
+type WatchGroup struct {
+	Paths []string
+	// Apply is called with values by their paths when any of them is changed.
+	// It is called while the watch lock is held, so it must not register watches.
+	Apply func(updates map[string][]byte) error
+}
+
+type watchGroupItem struct {
+	group *WatchGroup
+	last  map[string][]byte
+}
+
 type watchItem struct {
-	path   string
-	target Updatable
+	path      string
+	target    Updatable
+	lastValue []byte
+	onUpdate  func(old, new []byte)
+	// period overrides the client refresh period when it is positive.
+	period time.Duration
+	// next is the time of the next refresh.
+	next time.Time
+	// refresh is used instead of getting path and updating target when it is set.
+	refresh func() error
+	// ctx is canceled when the item is removed.
+	ctx    context.Context
+	cancel func()
+	// sensitive values are redacted from errors.
+	sensitive bool
 }
@@ -0,0 +1,49 @@
+package consul
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// FieldChange describes a field which differs between two structures.
+// Nil OldValue or NewValue means that the map entry is absent in that structure.
+type FieldChange struct {
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// Compare compares structures a and b of the same type field by field
+// and returns changes by paths of fields, as PullOrPush builds them with empty parent.
+// Unexported and skipped fields are ignored. It returns nil if structures are equal.
+// Options opts are applied to the client, e.g. WithPathNormalizer.
+func Compare(a, b interface{}, opts ...Option) ([]FieldChange, error) {
+	before, after := reflect.Indirect(reflect.ValueOf(a)), reflect.Indirect(reflect.ValueOf(b))
+	if !before.IsValid() || !after.IsValid() {
+		return nil, errors.New("a or b is nil")
+	}
+	if before.Type() != after.Type() {
+		return nil, errors.Errorf("can not compare %s with %s", before.Type(), after.Type())
+	}
+	if before.Kind() != reflect.Struct {
+		return nil, errors.New("a is not a structure")
+	}
+	c, err := newOfflineClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Stop()
+	var changes []FieldChange
+	c.diff("", before, after, func(path string, old, new reflect.Value) {
+		changes = append(changes, FieldChange{Path: path, OldValue: changeValue(old), NewValue: changeValue(new)})
+	})
+	return changes, nil
+}
+
+func changeValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
@@ -0,0 +1,75 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	type dbConfig struct {
+		Host string
+		Port uint16
+	}
+	type testStruct struct {
+		Name     string
+		Enabled  bool
+		Retries  int64
+		Ratio    float32
+		Timeout  time.Duration
+		Database dbConfig `consul:"name:database"`
+		Replica  *dbConfig
+		Labels   map[string]string
+		Secret   string `consul:"-"`
+		internal int
+	}
+	a := testStruct{
+		Name:     "api",
+		Retries:  3,
+		Ratio:    0.5,
+		Timeout:  time.Second,
+		Database: dbConfig{Host: "localhost", Port: 5432},
+		Labels:   map[string]string{"team": "core", "env": "dev"},
+		Secret:   "a",
+		internal: 1,
+	}
+	changes, err := Compare(a, &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes != nil {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+
+	b := a
+	b.Enabled = true
+	b.Retries = 5
+	b.Ratio = 0.25
+	b.Timeout = time.Minute
+	b.Database.Port = 6432
+	b.Replica = &dbConfig{Host: "replica"}
+	b.Labels = map[string]string{"team": "core", "tier": "1"}
+	b.Secret = "b"
+	b.internal = 2
+	changes, err = Compare(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FieldChange{
+		{Path: "enabled", OldValue: false, NewValue: true},
+		{Path: "retries", OldValue: int64(3), NewValue: int64(5)},
+		{Path: "ratio", OldValue: float32(0.5), NewValue: float32(0.25)},
+		{Path: "timeout", OldValue: time.Second, NewValue: time.Minute},
+		{Path: "database/port", OldValue: uint16(5432), NewValue: uint16(6432)},
+		{Path: "replica/host", OldValue: "", NewValue: "replica"},
+		{Path: "labels/env", OldValue: "dev", NewValue: nil},
+		{Path: "labels/tier", OldValue: nil, NewValue: "1"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("got %v", changes)
+	}
+
+	if _, err := Compare(a, dbConfig{}); err == nil {
+		t.Error("expected error for mismatched types")
+	}
+}
@@ -1,13 +1,87 @@
 package consul
 
-import consulapi "github.com/hashicorp/consul/api"
+import (
+	"context"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
 
 type consulKV struct {
-	kv *consulapi.KV
+	kv         *consulapi.KV
+	txn        *consulapi.Txn
+	session    *consulapi.Session
+	waitTime   time.Duration
+	datacenter string
+	namespace  string
+	partition  string
+	// retries is the maximum number of retries of failed idempotent calls.
+	retries int
+	backoff time.Duration
+	// sessionID is a session which written keys are associated with.
+	sessionID string
+	// onRetry is called before every retry of failed call.
+	onRetry func(attempt int, err error)
+}
+
+// do calls fn and retries it on retryable errors with exponential backoff.
+func (kv consulKV) do(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= kv.retries || !isRetryable(err) {
+			return err
+		}
+		if kv.onRetry != nil {
+			kv.onRetry(attempt+1, err)
+		}
+		timer := time.NewTimer(retryBackoff(kv.backoff, attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// Datacenter returns datacenter set with WithDatacenter,
+// it is used by middlewares to describe calls.
+func (kv consulKV) Datacenter() string {
+	return kv.datacenter
+}
+
+func (kv consulKV) queryOptions(ctx context.Context) *consulapi.QueryOptions {
+	return (&consulapi.QueryOptions{Datacenter: kv.datacenter, Namespace: kv.namespace, Partition: kv.partition}).WithContext(ctx)
+}
+
+func (kv consulKV) writeOptions(ctx context.Context) *consulapi.WriteOptions {
+	return (&consulapi.WriteOptions{Datacenter: kv.datacenter, Namespace: kv.namespace, Partition: kv.partition}).WithContext(ctx)
+}
+
+// waitTimeKey is a context key of wait time of blocking queries, which overrides the client wait time,
+// e.g. for watched values with period tag option.
+type waitTimeKey struct{}
+
+func (kv consulKV) blockingQueryOptions(ctx context.Context, waitIndex uint64) *consulapi.QueryOptions {
+	opts := kv.queryOptions(ctx)
+	opts.WaitIndex = waitIndex
+	opts.WaitTime = kv.waitTime
+	if wait, ok := ctx.Value(waitTimeKey{}).(time.Duration); ok {
+		opts.WaitTime = wait
+	}
+	return opts
 }
 
 func (kv consulKV) Get(path string) ([]byte, error) {
-	pair, _, err := kv.kv.Get(path, nil)
+	return kv.GetWithContext(context.Background(), path)
+}
+
+func (kv consulKV) GetWithContext(ctx context.Context, path string) ([]byte, error) {
+	var pair *consulapi.KVPair
+	err := kv.do(ctx, func() (err error) {
+		pair, _, err = kv.kv.Get(path, kv.queryOptions(ctx))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -17,7 +91,101 @@ func (kv consulKV) Get(path string) ([]byte, error) {
 	return pair.Value, nil
 }
 
+func (kv consulKV) GetMeta(path string) (KVMeta, error) {
+	_, meta, err := kv.GetPair(context.Background(), path)
+	return meta, err
+}
+
+func (kv consulKV) GetPair(ctx context.Context, path string) ([]byte, KVMeta, error) {
+	var pair *consulapi.KVPair
+	err := kv.do(ctx, func() (err error) {
+		pair, _, err = kv.kv.Get(path, kv.queryOptions(ctx))
+		return err
+	})
+	if err != nil || pair == nil {
+		return nil, KVMeta{}, err
+	}
+	return pair.Value, KVMeta{
+		Flags:       pair.Flags,
+		ModifyIndex: pair.ModifyIndex,
+		CreateIndex: pair.CreateIndex,
+		Session:     pair.Session,
+	}, nil
+}
+
+func (kv consulKV) GetWithIndex(ctx context.Context, path string, waitIndex uint64) ([]byte, uint64, error) {
+	pair, meta, err := kv.kv.Get(path, kv.blockingQueryOptions(ctx, waitIndex))
+	if err != nil {
+		return nil, 0, err
+	}
+	if pair == nil {
+		return nil, meta.LastIndex, nil
+	}
+	return pair.Value, meta.LastIndex, nil
+}
+
+func (kv consulKV) WaitTree(ctx context.Context, prefix string, waitIndex uint64) (uint64, error) {
+	_, meta, err := kv.kv.Keys(prefix, "", kv.blockingQueryOptions(ctx, waitIndex))
+	if err != nil {
+		return 0, err
+	}
+	return meta.LastIndex, nil
+}
+
 func (kv consulKV) Put(path string, value []byte) error {
-	_, err := kv.kv.Put(&consulapi.KVPair{Key: path, Value: value}, nil)
-	return err
+	return kv.PutWithContext(context.Background(), path, value)
+}
+
+func (kv consulKV) PutWithContext(ctx context.Context, path string, value []byte) error {
+	if kv.sessionID != "" {
+		return kv.acquire(ctx, path, value)
+	}
+	return kv.do(ctx, func() error {
+		_, err := kv.kv.Put(&consulapi.KVPair{Key: path, Value: value}, kv.writeOptions(ctx))
+		return err
+	})
+}
+
+// acquire puts value and associates key with the session, so it is deleted when the session expires.
+// Keys held by other sessions are not changed.
+func (kv consulKV) acquire(ctx context.Context, path string, value []byte) error {
+	var acquired bool
+	err := kv.do(ctx, func() (err error) {
+		acquired, _, err = kv.kv.Acquire(&consulapi.KVPair{Key: path, Value: value, Session: kv.sessionID}, kv.writeOptions(ctx))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return ErrLockHeld
+	}
+	return nil
+}
+
+func (kv consulKV) Delete(path string) error {
+	return kv.do(context.Background(), func() error {
+		_, err := kv.kv.Delete(path, kv.writeOptions(context.Background()))
+		return err
+	})
+}
+
+func (kv consulKV) DeleteTree(prefix string) error {
+	return kv.do(context.Background(), func() error {
+		_, err := kv.kv.DeleteTree(prefix, kv.writeOptions(context.Background()))
+		return err
+	})
+}
+
+func (kv consulKV) Keys(prefix string) (keys []string, err error) {
+	err = kv.do(context.Background(), func() (err error) {
+		keys, _, err = kv.kv.Keys(prefix, "", kv.queryOptions(context.Background()))
+		return err
+	})
+	return keys, err
+}
+
+func (kv consulKV) CAS(path string, value []byte, index uint64) (bool, error) {
+	ok, _, err := kv.kv.CAS(&consulapi.KVPair{Key: path, Value: value, ModifyIndex: index}, kv.writeOptions(context.Background()))
+	return ok, err
 }
@@ -0,0 +1,428 @@
+package consul
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// consulServer is a fake Consul HTTP API which records query parameters of requests.
+// It stores KV values, serves blocking queries for them and supports sessions and locks of keys.
+type consulServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	queries  []map[string]string
+	index    uint64
+	pairs    map[string]string
+	sessions map[string]bool
+	holders  map[string]string
+	renewals int
+}
+
+func newConsulServer(t *testing.T) *consulServer {
+	s := &consulServer{index: 1, pairs: map[string]string{}, sessions: map[string]bool{}, holders: map[string]string{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *consulServer) handle(w http.ResponseWriter, r *http.Request) {
+	query := map[string]string{
+		"method":    r.Method,
+		"path":      r.URL.Path,
+		"dc":        r.URL.Query().Get("dc"),
+		"token":     r.Header.Get("X-Consul-Token"),
+		"acquire":   r.URL.Query().Get("acquire"),
+		"ns":        r.URL.Query().Get("ns"),
+		"partition": r.URL.Query().Get("partition"),
+		"wait":      r.URL.Query().Get("wait"),
+	}
+	if waitIndex, err := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); err == nil {
+		// Blocking query returns after a short wait, if nothing is changed.
+		for i := 0; i < 10 && s.currentIndex() == waitIndex; i++ {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queries = append(s.queries, query)
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		id := fmt.Sprint("session-", len(s.sessions)+1)
+		s.sessions[id] = true
+		fmt.Fprintf(w, `{"ID": %q}`, id)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")
+		if !s.sessions[id] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.renewals++
+		fmt.Fprintf(w, `[{"ID": %q}]`, id)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/")
+		delete(s.sessions, id)
+		for key, holder := range s.holders {
+			if holder == id {
+				delete(s.holders, key)
+			}
+		}
+		fmt.Fprint(w, "true")
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == http.MethodGet:
+		s.getKV(w, r, strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == http.MethodPut:
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		if id := r.URL.Query().Get("acquire"); id != "" {
+			if holder, ok := s.holders[key]; ok && holder != id {
+				fmt.Fprint(w, "false")
+				return
+			}
+			s.holders[key] = id
+		}
+		if id := r.URL.Query().Get("release"); id != "" && s.holders[key] == id {
+			delete(s.holders, key)
+		}
+		value, _ := io.ReadAll(r.Body)
+		s.pairs[key] = string(value)
+		s.index++
+		fmt.Fprint(w, "true")
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == http.MethodDelete:
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		_, recurse := r.URL.Query()["recurse"]
+		for k := range s.pairs {
+			if k == key || recurse && strings.HasPrefix(k, key) {
+				delete(s.pairs, k)
+			}
+		}
+		s.index++
+		fmt.Fprint(w, "true")
+	case r.Method == http.MethodGet:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		fmt.Fprint(w, "true")
+	}
+}
+
+// getKV serves reads of a key, keys or values under prefix.
+// It should be called with lock held.
+func (s *consulServer) getKV(w http.ResponseWriter, r *http.Request, key string) {
+	_, recurse := r.URL.Query()["recurse"]
+	_, keysOnly := r.URL.Query()["keys"]
+	var pairs consulapi.KVPairs
+	var keys []string
+	for k, v := range s.pairs {
+		if k == key || (recurse || keysOnly) && strings.HasPrefix(k, key) {
+			pairs = append(pairs, &consulapi.KVPair{Key: k, Value: []byte(v), ModifyIndex: s.index})
+			keys = append(keys, k)
+		}
+	}
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if keysOnly {
+		_ = json.NewEncoder(w).Encode(keys)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(pairs)
+}
+
+func (s *consulServer) currentIndex() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.index
+}
+
+// set puts value to key, like it is changed by another client.
+func (s *consulServer) set(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pairs[key] = value
+	s.index++
+}
+
+// holder returns session which holds lock of key.
+func (s *consulServer) holder(key string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.holders[key]
+}
+
+// recorded returns queries received so far.
+func (s *consulServer) recorded() []map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]map[string]string(nil), s.queries...)
+}
+
+func (s *consulServer) client(t *testing.T, opts ...Option) *Client {
+	c, err := NewClient(append([]Option{
+		WithConsulConfig(&consulapi.Config{Address: s.URL}),
+		DisableWatch,
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestWithDatacenter(t *testing.T) {
+	s := newConsulServer(t)
+	primary, secondary := s.client(t, WithDatacenter("dc1")), s.client(t, WithDatacenter("dc2"))
+	if _, err := primary.kv.Get("global/key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := secondary.kv.Put("local/key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.kv.Keys("global"); err != nil {
+		t.Fatal(err)
+	}
+	if err := secondary.kv.Delete("local/key"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]string{
+		{"method": http.MethodGet, "path": "/v1/kv/global/key", "dc": "dc1"},
+		{"method": http.MethodPut, "path": "/v1/kv/local/key", "dc": "dc2"},
+		{"method": http.MethodGet, "path": "/v1/kv/global", "dc": "dc1"},
+		{"method": http.MethodDelete, "path": "/v1/kv/local/key", "dc": "dc2"},
+	}
+	if len(s.queries) != len(expected) {
+		t.Fatalf("expected %d queries, got %v", len(expected), s.queries)
+	}
+	for i := range expected {
+		for k, v := range expected[i] {
+			if s.queries[i][k] != v {
+				t.Errorf("query %d: expected %s %q, got %q", i, k, v, s.queries[i][k])
+			}
+		}
+	}
+}
+
+func TestWithACLToken(t *testing.T) {
+	s := newConsulServer(t)
+	c := s.client(t, WithACLToken("secret"))
+	if _, err := c.kv.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.kv.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kv.Keys("prefix"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kv.CAS("key", []byte("value"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.kv.DeleteTree("prefix"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.queries) != 5 {
+		t.Fatalf("expected 5 queries, got %v", s.queries)
+	}
+	for i, query := range s.queries {
+		if query["token"] != "secret" {
+			t.Errorf("query %d: expected token, got %q", i, query["token"])
+		}
+	}
+}
+
+func TestWithTLS(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Consul-Index", "1")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+	address := strings.TrimPrefix(s.URL, "https://")
+	newClient := func(opts ...Option) (*Client, error) {
+		return NewClient(append([]Option{WithConsulConfig(&consulapi.Config{Address: address}), DisableWatch}, opts...)...)
+	}
+
+	c, err := newClient(WithTLS("", "", caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kv.Get("key"); err != nil {
+		t.Errorf("with CA: %v", err)
+	}
+	c, err = newClient(WithTLS("", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kv.Get("key"); err == nil {
+		t.Error("expected certificate error without CA")
+	}
+	c, err = newClient(WithTLS("", "", ""), InsecureSkipVerify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kv.Get("key"); err != nil {
+		t.Errorf("insecure: %v", err)
+	}
+	if _, err := newClient(WithTLS("missing.crt", "missing.key", caFile)); err == nil {
+		t.Error("expected error on missing client certificate")
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	var calls int
+	statuses := []int{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		w.Header().Set("X-Consul-Index", "1")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`[{"Key": "key", "Value": "dmFsdWU="}]`))
+	}))
+	defer s.Close()
+	c, err := NewClient(WithConsulConfig(&consulapi.Config{Address: s.URL}), DisableWatch, WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses = []int{http.StatusInternalServerError, http.StatusServiceUnavailable}
+	value, err := c.kv.Get("key")
+	if err != nil || string(value) != "value" || calls != 3 {
+		t.Errorf("got %q, %v after %d calls", value, err, calls)
+	}
+
+	calls, statuses = 0, []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}
+	if _, err := c.kv.Get("key"); err == nil || calls != 3 {
+		t.Errorf("expected error after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	calls, statuses = 0, []int{http.StatusForbidden}
+	if err := c.kv.Put("key", []byte("value")); err == nil || calls != 1 {
+		t.Errorf("expected error without retries, got %v after %d calls", err, calls)
+	}
+}
+
+func TestWithSessionID(t *testing.T) {
+	s := newConsulServer(t)
+	c := s.client(t, WithSessionID("sid"))
+	if err := c.kv.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kv.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.client(t).kv.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"sid", "", ""}
+	if len(s.queries) != len(expected) {
+		t.Fatalf("expected %d queries, got %v", len(expected), s.queries)
+	}
+	for i, sid := range expected {
+		if s.queries[i]["acquire"] != sid {
+			t.Errorf("query %d: expected session %q, got %q", i, sid, s.queries[i]["acquire"])
+		}
+	}
+}
+
+func TestWithNamespace(t *testing.T) {
+	s := newConsulServer(t)
+	c := s.client(t, WithNamespace("team"))
+	if _, err := c.kv.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.kv.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client(t).kv.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"team", "team", ""}
+	if len(s.queries) != len(expected) {
+		t.Fatalf("expected %d queries, got %v", len(expected), s.queries)
+	}
+	for i, ns := range expected {
+		if s.queries[i]["ns"] != ns {
+			t.Errorf("query %d: expected namespace %q, got %q", i, ns, s.queries[i]["ns"])
+		}
+	}
+}
+
+func TestClient_Partition(t *testing.T) {
+	s := newConsulServer(t)
+	c := s.client(t, WithNamespace("team"))
+	defer c.Stop()
+	partitioned := c.Partition("billing")
+	defer partitioned.Stop()
+	if _, err := partitioned.kv.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := partitioned.kv.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.kv.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Partition("").kv.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]string{
+		{"method": http.MethodGet, "partition": "billing", "ns": "team"},
+		{"method": http.MethodPut, "partition": "billing", "ns": "team"},
+		{"method": http.MethodGet, "partition": "", "ns": "team"},
+		{"method": http.MethodGet, "partition": "", "ns": "team"},
+	}
+	if len(s.queries) != len(expected) {
+		t.Fatalf("expected %d queries, got %v", len(expected), s.queries)
+	}
+	for i := range expected {
+		for k, v := range expected[i] {
+			if s.queries[i][k] != v {
+				t.Errorf("query %d: expected %s %q, got %q", i, k, v, s.queries[i][k])
+			}
+		}
+	}
+}
+
+func TestClient_BlockingWatchPeriod(t *testing.T) {
+	type testStruct struct {
+		Fast String `consul:"period:10ms"`
+		Slow String
+	}
+	s := newConsulServer(t)
+	c, err := NewClient(WithConsulConfig(&consulapi.Config{Address: s.URL}), WaitTime(time.Minute), RefreshPeriod(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	if err := c.PullOrPush("service", &testStruct{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"/v1/kv/service/fast": "10ms", "/v1/kv/service/slow": "60000ms"}
+	waitFor(t, func() bool {
+		waits := map[string]string{}
+		for _, query := range s.recorded() {
+			if query["wait"] != "" {
+				waits[query["path"]] = query["wait"]
+			}
+		}
+		return reflect.DeepEqual(waits, expected)
+	})
+}
@@ -1,19 +1,160 @@
 package consul
 
 import (
+	"net"
+	"net/url"
 	"reflect"
+	"regexp"
+	"strconv"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 func init() {
 	RegisterWellKnownType(reflect.TypeOf(time.Duration(0)), timeDuration)
 	RegisterWellKnownType(reflect.TypeOf(time.Time{}), timeTime)
+	RegisterWellKnownType(reflect.TypeOf(net.IP{}), netIP)
+	RegisterWellKnownType(reflect.TypeOf(net.HardwareAddr(nil)), netHardwareAddr)
+	RegisterWellKnownType(reflect.TypeOf(regexp.Regexp{}), regexpRegexp)
+	RegisterWellKnownType(reflect.TypeOf(&regexp.Regexp{}), regexpRegexpPtr)
+	RegisterWellKnownType(reflect.TypeOf(url.URL{}), urlURL)
+	RegisterWellKnownType(reflect.TypeOf(&url.URL{}), urlURLPtr)
+
+	formatParsers[reflect.TypeOf(time.Time{})] = timeTimeFormat
+
+	stringifiers[reflect.TypeOf(time.Duration(0))] = timeDurationString
+	stringifiers[reflect.TypeOf(time.Time{})] = timeTimeString
+	stringifiers[reflect.TypeOf(net.IP{})] = netIPString
+	stringifiers[reflect.TypeOf(regexp.Regexp{})] = regexpRegexpString
+	stringifiers[reflect.TypeOf(&regexp.Regexp{})] = regexpRegexpPtrString
+	stringifiers[reflect.TypeOf(url.URL{})] = urlURLString
+	stringifiers[reflect.TypeOf(&url.URL{})] = urlURLPtrString
 }
 
+// formatParsers are used instead of well known type parsers
+// when field has format tag option.
+var formatParsers = map[reflect.Type]func(format string, raw []byte) (interface{}, error){}
+
 func timeTime(_ string, raw []byte) (interface{}, error) {
-	return time.Parse(time.RFC3339, string(raw))
+	return timeTimeFormat(time.RFC3339, raw)
+}
+
+func timeTimeFormat(format string, raw []byte) (interface{}, error) {
+	if len(raw) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse(format, string(raw))
+}
+
+// timeTimeString formats t with nanoseconds, if any, so it is parsed back to the same time,
+// including zero time. Zero time with custom format is empty, as the format may drop the year.
+func timeTimeString(v reflect.Value, opts tagOpts) (string, error) {
+	t := v.Interface().(time.Time)
+	if opts.Format != nil {
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(*opts.Format), nil
+	}
+	return t.Format(time.RFC3339Nano), nil
 }
 
+// timeDuration also accepts integer nanoseconds, which were written for durations by older versions.
 func timeDuration(_ string, raw []byte) (interface{}, error) {
-	return time.ParseDuration(string(raw))
+	d, err := time.ParseDuration(string(raw))
+	if err != nil {
+		if n, intErr := strconv.ParseInt(string(raw), 10, 64); intErr == nil {
+			return time.Duration(n), nil
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+func timeDurationString(v reflect.Value, _ tagOpts) (string, error) {
+	return v.Interface().(time.Duration).String(), nil
+}
+
+func netIP(_ string, raw []byte) (interface{}, error) {
+	if len(raw) == 0 {
+		return net.IP(nil), nil
+	}
+	ip := net.ParseIP(string(raw))
+	if ip == nil {
+		return nil, errors.Errorf("invalid IP address '%s'", raw)
+	}
+	return ip, nil
+}
+
+func netIPString(v reflect.Value, _ tagOpts) (string, error) {
+	ip := v.Interface().(net.IP)
+	if ip == nil {
+		return "", nil
+	}
+	return ip.String(), nil
+}
+
+func netHardwareAddr(_ string, raw []byte) (interface{}, error) {
+	if len(raw) == 0 {
+		return net.HardwareAddr(nil), nil
+	}
+	return net.ParseMAC(string(raw))
+}
+
+// regexpRegexp compiles empty value to the empty pattern, which matches any string.
+func regexpRegexp(_ string, raw []byte) (interface{}, error) {
+	re, err := regexp.Compile(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	return *re, nil
+}
+
+func regexpRegexpPtr(_ string, raw []byte) (interface{}, error) {
+	if len(raw) == 0 {
+		return (*regexp.Regexp)(nil), nil
+	}
+	return regexp.Compile(string(raw))
+}
+
+func regexpRegexpString(v reflect.Value, _ tagOpts) (string, error) {
+	re := v.Interface().(regexp.Regexp)
+	return re.String(), nil
+}
+
+func regexpRegexpPtrString(v reflect.Value, _ tagOpts) (string, error) {
+	re := v.Interface().(*regexp.Regexp)
+	if re == nil {
+		return "", nil
+	}
+	return re.String(), nil
+}
+
+func urlURL(_ string, raw []byte) (interface{}, error) {
+	u, err := url.Parse(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	return *u, nil
+}
+
+func urlURLPtr(_ string, raw []byte) (interface{}, error) {
+	if len(raw) == 0 {
+		return (*url.URL)(nil), nil
+	}
+	return url.Parse(string(raw))
+}
+
+func urlURLString(v reflect.Value, _ tagOpts) (string, error) {
+	u := v.Interface().(url.URL)
+	return u.String(), nil
+}
+
+func urlURLPtrString(v reflect.Value, _ tagOpts) (string, error) {
+	u := v.Interface().(*url.URL)
+	if u == nil {
+		return "", nil
+	}
+	return u.String(), nil
 }
@@ -0,0 +1,231 @@
+package consul
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNetIP(t *testing.T) {
+	type testStruct struct {
+		V4    net.IP `consul:"default:192.168.1.1"`
+		V6    net.IP `consul:"default:::1"`
+		Empty net.IP
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if !config.V4.Equal(net.IPv4(192, 168, 1, 1)) || config.V4.String() != "192.168.1.1" {
+		t.Errorf("V4: got %v", config.V4)
+	}
+	if !config.V6.Equal(net.IPv6loopback) || config.V6.String() != "::1" {
+		t.Errorf("V6: got %v", config.V6)
+	}
+	if config.Empty != nil {
+		t.Errorf("Empty: got %v", config.Empty)
+	}
+
+	type invalidStruct struct {
+		IP net.IP `consul:"default:300.1.1.1"`
+	}
+	if err := c.PullOrPush("invalid", &invalidStruct{}); err == nil {
+		t.Error("expected error on invalid IP")
+	}
+}
+
+func TestNetHardwareAddr(t *testing.T) {
+	type testStruct struct {
+		EUI48 net.HardwareAddr `consul:"name:eui48;default:00:1A:2b:3c:4d:5e"`
+		EUI64 net.HardwareAddr `consul:"name:eui64;default:02-00-5e-10-00-00-00-01"`
+		Empty net.HardwareAddr
+	}
+	kv := testKV{}
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.EUI48.String() != "00:1a:2b:3c:4d:5e" {
+		t.Errorf("EUI48: got %v", config.EUI48)
+	}
+	if config.EUI64.String() != "02:00:5e:10:00:00:00:01" {
+		t.Errorf("EUI64: got %v", config.EUI64)
+	}
+	if config.Empty != nil {
+		t.Errorf("Empty: got %v", config.Empty)
+	}
+
+	kv["service/eui48"] = []byte("AA:BB:CC:DD:EE:FF")
+	loaded := testStruct{}
+	if err := c.PullOrPush("service", &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.EUI48.String() != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("round trip: got %v", loaded.EUI48)
+	}
+
+	type invalidStruct struct {
+		Addr net.HardwareAddr `consul:"default:00:1a:2b"`
+	}
+	if err := c.PullOrPush("invalid", &invalidStruct{}); err == nil {
+		t.Error("expected error on invalid MAC address")
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	type testStruct struct {
+		PathPattern *regexp.Regexp `consul:"default:^/api/v[0-9]+/"`
+		Origin      regexp.Regexp  `consul:"default:example\\.com$"`
+		Empty       *regexp.Regexp
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.PathPattern == nil || !config.PathPattern.MatchString("/api/v2/users") || config.PathPattern.MatchString("/v2/api/") {
+		t.Errorf("PathPattern: got %v", config.PathPattern)
+	}
+	if !config.Origin.MatchString("www.example.com") || config.Origin.MatchString("example-com") {
+		t.Errorf("Origin: got %v", config.Origin.String())
+	}
+	if config.Empty != nil {
+		t.Errorf("Empty: got %v", config.Empty)
+	}
+	kv, err := MarshalConsul("service", &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv["service/path.pattern"] != "^/api/v[0-9]+/" || kv["service/origin"] != `example\.com$` || kv["service/empty"] != "" {
+		t.Errorf("marshal: got %v", kv)
+	}
+
+	type invalidStruct struct {
+		Pattern *regexp.Regexp `consul:"default:a(b"`
+	}
+	if err := c.PullOrPush("invalid", &invalidStruct{}); err == nil {
+		t.Error("expected error on invalid pattern")
+	}
+}
+
+func TestURL(t *testing.T) {
+	type testStruct struct {
+		Endpoint *url.URL `consul:"default:https://example.com/hook?token=abc&v=2"`
+		Value    url.URL  `consul:"default:postgres://user@db:5432/app"`
+		Empty    *url.URL
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Endpoint == nil || config.Endpoint.Host != "example.com" || config.Endpoint.Query().Get("token") != "abc" {
+		t.Errorf("Endpoint: got %v", config.Endpoint)
+	}
+	if config.Value.Scheme != "postgres" || config.Value.User.Username() != "user" {
+		t.Errorf("Value: got %v", config.Value)
+	}
+	if config.Empty != nil {
+		t.Errorf("Empty: got %v", config.Empty)
+	}
+
+	type invalidStruct struct {
+		Endpoint *url.URL `consul:"default:http://[::1"`
+	}
+	if err := c.PullOrPush("invalid", &invalidStruct{}); err == nil {
+		t.Error("expected error on malformed URL")
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	type testStruct struct {
+		RFC3339 time.Time `consul:"default:2006-01-02T15:04:05Z"`
+		Custom  time.Time `consul:"format:2006/01/02;default:2021/03/04"`
+		Empty   time.Time `consul:"format:2006/01/02"`
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{Empty: time.Now()}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if !config.RFC3339.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("RFC3339: got %v", config.RFC3339)
+	}
+	if !config.Custom.Equal(time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Custom: got %v", config.Custom)
+	}
+	if !config.Empty.IsZero() {
+		t.Errorf("Empty: got %v", config.Empty)
+	}
+
+	type roundTripStruct struct {
+		Zero    time.Time
+		Precise time.Time
+	}
+	in := roundTripStruct{Precise: time.Date(2021, 3, 4, 5, 6, 7, 890, time.UTC)}
+	kv, err := MarshalConsul("service", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv["service/zero"] != "0001-01-01T00:00:00Z" {
+		t.Errorf("Zero: got %q", kv["service/zero"])
+	}
+	var out roundTripStruct
+	if err := UnmarshalConsul("service", kv, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Zero.IsZero() || !out.Precise.Equal(in.Precise) {
+		t.Errorf("got %v", out)
+	}
+
+	type invalidStruct struct {
+		Time time.Time `consul:"format:2006/01/02;default:2021-03-04"`
+	}
+	if err := c.PullOrPush("invalid", &invalidStruct{}); err == nil {
+		t.Error("expected error on value in wrong format")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	type testStruct struct {
+		Timeout time.Duration
+		Legacy  time.Duration
+	}
+	kv := map[string]string{"service/timeout": "5m30s", "service/legacy": "300000000000"}
+	config := testStruct{}
+	if err := UnmarshalConsul("service", kv, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Timeout != 5*time.Minute+30*time.Second || config.Legacy != 5*time.Minute {
+		t.Errorf("got %+v", config)
+	}
+	marshaled, err := MarshalConsul("service", &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marshaled["service/timeout"] != "5m30s" || marshaled["service/legacy"] != "5m0s" {
+		t.Errorf("got %v", marshaled)
+	}
+	if err := UnmarshalConsul("service", map[string]string{"service/timeout": "5 minutes"}, &config); err == nil {
+		t.Error("expected error on invalid duration")
+	}
+}
@@ -0,0 +1,127 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// FieldDiff describes a value which differs between local structure and Consul.
+// Empty LocalValue or ConsulValue means that the value is absent on that side.
+type FieldDiff struct {
+	Path        string
+	LocalValue  string
+	ConsulValue string
+}
+
+// Diff loads values of current's type from path and compares them with current field by field.
+// It does not write anything to Consul.
+func (c *Client) Diff(path string, current interface{}) ([]FieldDiff, error) {
+	local := reflect.Indirect(reflect.ValueOf(current))
+	if !local.IsValid() {
+		return nil, errors.New("current is nil")
+	}
+	remote := reflect.New(local.Type()).Elem()
+	if err := c.pullOrPush(context.Background(), modeDryRun, path, remote, nil); err != nil {
+		return nil, err
+	}
+	var diffs []FieldDiff
+	c.diff(path, local, remote, func(path string, local, remote reflect.Value) {
+		diffs = append(diffs, FieldDiff{Path: path, LocalValue: diffValue(local), ConsulValue: diffValue(remote)})
+	})
+	return diffs, nil
+}
+
+// diff calls differ for every value which differs between local and remote.
+// Map entries which are absent on one side are passed as invalid values.
+func (c *Client) diff(consulPath string, local, remote reflect.Value, differ func(path string, local, remote reflect.Value)) {
+	if _, ok := wellKnowTypeParsers[local.Type()]; !ok {
+		switch local.Kind() {
+		case reflect.Ptr:
+			if local.IsNil() && remote.IsNil() {
+				return
+			}
+			c.diff(consulPath, derefOrZero(local), derefOrZero(remote), differ)
+			return
+		case reflect.Struct:
+			for i, n := 0, local.NumField(); i < n; i++ {
+				fieldType := local.Type().Field(i)
+				opts := makeTagOpts(fieldType.Tag.Get("consul"))
+				if fieldType.PkgPath != "" || opts.Skip {
+					continue
+				}
+				fieldDiffer := differ
+				if opts.Sensitive {
+					fieldDiffer = func(path string, local, remote reflect.Value) {
+						differ(path, redactValue(local), redactValue(remote))
+					}
+				}
+				if opts.Flatten {
+					// Flatten values are stored in a single key, so they are compared as a whole.
+					if !reflect.DeepEqual(local.Field(i).Interface(), remote.Field(i).Interface()) {
+						fieldDiffer(c.makeConsulPath(consulPath, fieldType), local.Field(i), remote.Field(i))
+					}
+					continue
+				}
+				c.diff(c.makeConsulPath(consulPath, fieldType), local.Field(i), remote.Field(i), fieldDiffer)
+			}
+			return
+		case reflect.Map:
+			keys := map[string]reflect.Value{}
+			for _, k := range local.MapKeys() {
+				keys[k.String()] = k
+			}
+			for _, k := range remote.MapKeys() {
+				keys[k.String()] = k
+			}
+			names := make([]string, 0, len(keys))
+			for name := range keys {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				l, r := local.MapIndex(keys[name]), remote.MapIndex(keys[name])
+				if l.IsValid() && r.IsValid() && reflect.DeepEqual(l.Interface(), r.Interface()) {
+					continue
+				}
+				differ(path.Join(consulPath, name), l, r)
+			}
+			return
+		}
+	}
+	if reflect.DeepEqual(local.Interface(), remote.Interface()) {
+		return
+	}
+	differ(consulPath, local, remote)
+}
+
+// redactValue replaces valid v with redacted string.
+func redactValue(v reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	return reflect.ValueOf(redacted)
+}
+
+func derefOrZero(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return reflect.Zero(v.Type().Elem())
+	}
+	return v.Elem()
+}
+
+func diffValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if v.CanAddr() {
+		if s, ok := v.Addr().Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
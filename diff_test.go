@@ -0,0 +1,49 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClient_Diff(t *testing.T) {
+	type dbConfig struct {
+		Host string
+		Port int
+	}
+	type testStruct struct {
+		Name   string
+		DB     dbConfig `consul:"name:db"`
+		Labels map[string]string
+	}
+	kv := testKV{
+		"service/name":           []byte("svc"),
+		"service/db/host":        []byte("localhost"),
+		"service/db/port":        []byte("5432"),
+		"service/labels/env":     []byte("prod"),
+		"service/labels/removed": []byte("x"),
+	}
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := testStruct{
+		Name:   "svc",
+		DB:     dbConfig{Host: "db.local", Port: 5432},
+		Labels: map[string]string{"env": "prod", "added": "y"},
+	}
+	diffs, err := c.Diff("service", &current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FieldDiff{
+		{Path: "service/db/host", LocalValue: "db.local", ConsulValue: "localhost"},
+		{Path: "service/labels/added", LocalValue: "y"},
+		{Path: "service/labels/removed", ConsulValue: "x"},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %+v", diffs)
+	}
+	if len(kv) != 5 {
+		t.Errorf("unexpected writes: %v", kv)
+	}
+}
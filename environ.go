@@ -0,0 +1,68 @@
+package consul
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// ExportToEnv returns values of all fields of i as sorted KEY=VALUE pairs,
+// which may be passed to exec.Cmd.Env. Names are full paths under parent,
+// like ones returned by MarshalConsul, in upper snake case:
+// field Port of nested structure Database under parent service is SERVICE_DATABASE_PORT.
+// Values are not escaped, as they are not passed through shell.
+func ExportToEnv(parent string, i interface{}) ([]string, error) {
+	kv, err := MarshalConsul(parent, i)
+	if err != nil {
+		return nil, err
+	}
+	env := make([]string, 0, len(kv))
+	for path, value := range kv {
+		env = append(env, envName(path)+"="+value)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// ImportFromEnv loads i from environment variables named like ExportToEnv names them,
+// like PullWithDefaults loads it from Consul: missing variables are filled from default tags.
+// Map entries are loaded from variables prefixed with the map name, their keys are lower cased.
+// It does not connect to Consul.
+func ImportFromEnv(parent string, i interface{}) error {
+	paths, err := ConsulPath(parent, i)
+	if err != nil {
+		return err
+	}
+	environ := os.Environ()
+	kv := map[string]string{}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "/") {
+			prefix := envName(path) + "_"
+			for _, pair := range environ {
+				eq := strings.IndexByte(pair, '=')
+				if eq > len(prefix) && strings.HasPrefix(pair, prefix) {
+					kv[path+strings.ToLower(pair[len(prefix):eq])] = pair[eq+1:]
+				}
+			}
+			continue
+		}
+		if value, ok := os.LookupEnv(envName(path)); ok {
+			kv[path] = value
+		}
+	}
+	return UnmarshalConsul(parent, kv, i)
+}
+
+// envName converts path to environment variable name:
+// letters are upper cased and all other symbols except digits are replaced with underscores.
+func envName(path string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, strings.Trim(path, "/"))
+}
@@ -0,0 +1,113 @@
+package consul
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type envTestConfig struct {
+	Name     string `consul:"default:api"`
+	Greeting string
+	Database struct {
+		Host     string `consul:"default:localhost"`
+		Port     int    `consul:"default:5432"`
+		MaxConns int
+	} `consul:"name:database"`
+	Labels map[string]string
+}
+
+func TestExportToEnv(t *testing.T) {
+	var config envTestConfig
+	config.Name = "api"
+	config.Greeting = `it's "$HOME" & co`
+	config.Database.Host = "db.local"
+	config.Database.Port = 5432
+	config.Database.MaxConns = 10
+	config.Labels = map[string]string{"team": "core"}
+	env, err := ExportToEnv("my-service", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"MY_SERVICE_DATABASE_HOST=db.local",
+		"MY_SERVICE_DATABASE_MAX_CONNS=10",
+		"MY_SERVICE_DATABASE_PORT=5432",
+		`MY_SERVICE_GREETING=it's "$HOME" & co`,
+		"MY_SERVICE_LABELS_TEAM=core",
+		"MY_SERVICE_NAME=api",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("got %q", env)
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not found")
+	}
+	cmd := exec.Command(sh, "-c", `printf '%s' "$MY_SERVICE_GREETING"`)
+	cmd.Env = env
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != config.Greeting {
+		t.Errorf("got %q from subprocess", out)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for path, expected := range map[string]string{
+		"service/database.host": "SERVICE_DATABASE_HOST",
+		"/name":                 "NAME",
+		"a-b/c d":               "A_B_C_D",
+	} {
+		if name := envName(path); name != expected {
+			t.Errorf("%s: got %s", path, name)
+		}
+	}
+}
+
+func TestImportFromEnv(t *testing.T) {
+	type testStruct struct {
+		Name     string `consul:"default:api"`
+		Enabled  bool
+		Retries  int
+		Ratio    float64
+		Size     uint16
+		Timeout  time.Duration `consul:"default:5s"`
+		Hosts    []string
+		Database struct {
+			Host string `consul:"default:localhost"`
+			Port int
+		} `consul:"name:database"`
+		Labels map[string]string
+	}
+	t.Setenv("SVC_ENABLED", "true")
+	t.Setenv("SVC_RETRIES", "-3")
+	t.Setenv("SVC_RATIO", "0.5")
+	t.Setenv("SVC_SIZE", "512")
+	t.Setenv("SVC_HOSTS", "a,b")
+	t.Setenv("SVC_DATABASE_PORT", "5432")
+	t.Setenv("SVC_LABELS_TEAM", "core")
+	var config testStruct
+	if err := ImportFromEnv("svc", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "api" || !config.Enabled || config.Retries != -3 || config.Ratio != 0.5 || config.Size != 512 ||
+		config.Timeout != 5*time.Second || !reflect.DeepEqual(config.Hosts, []string{"a", "b"}) {
+		t.Errorf("got %+v", config)
+	}
+	if config.Database.Host != "localhost" || config.Database.Port != 5432 {
+		t.Errorf("got %+v", config.Database)
+	}
+	if !reflect.DeepEqual(config.Labels, map[string]string{"team": "core"}) {
+		t.Errorf("got %v", config.Labels)
+	}
+
+	t.Setenv("SVC_RETRIES", "many")
+	if err := ImportFromEnv("svc", &config); err == nil {
+		t.Error("expected error for invalid value")
+	}
+}
@@ -0,0 +1,92 @@
+package consul
+
+import (
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// eventClient is the part of Consul events API used by the client.
+// It is implemented by *consulapi.Event.
+type eventClient interface {
+	Fire(params *consulapi.UserEvent, q *consulapi.WriteOptions) (string, *consulapi.WriteMeta, error)
+	List(name string, q *consulapi.QueryOptions) ([]*consulapi.UserEvent, *consulapi.QueryMeta, error)
+}
+
+// PublishEvent fires Consul user event name with payload,
+// which is delivered to subscribers of all clients with SubscribeEvent.
+// It returns ErrNotSupported if KV is set with SetKV.
+func (c *Client) PublishEvent(name string, payload []byte) error {
+	if c.events == nil {
+		return ErrNotSupported
+	}
+	event := &consulapi.UserEvent{Name: name, Payload: payload}
+	if _, _, err := c.events.Fire(event, &consulapi.WriteOptions{Datacenter: c.opts.datacenter}); err != nil {
+		return errors.Wrapf(err, "fire event '%s'", name)
+	}
+	return nil
+}
+
+// SubscribeEvent calls fn with payload of every Consul user event name fired after the call,
+// until the client is stopped. Events are watched by Consul blocking queries,
+// fn is called from the watch goroutine, so it should not block.
+// Consul keeps a limited number of recent events, so events may be lost under heavy load.
+// It returns ErrNotSupported if KV is set with SetKV.
+func (c *Client) SubscribeEvent(name string, fn func(payload []byte)) error {
+	if c.events == nil {
+		return ErrNotSupported
+	}
+	// Events fired before the subscription are skipped.
+	events, meta, err := c.events.List(name, c.eventQueryOptions(0))
+	if err != nil {
+		return errors.Wrapf(err, "list events '%s'", name)
+	}
+	go c.runEventWatch(name, fn, meta.LastIndex, lastEventTime(events))
+	return nil
+}
+
+// runEventWatch calls fn for events with Lamport time after lastTime.
+// Index of events is a hash of the last event ID, so it is used only to block until new events,
+// and Lamport time, which grows with every event, is used to skip delivered ones.
+func (c *Client) runEventWatch(name string, fn func(payload []byte), index, lastTime uint64) {
+	for {
+		events, meta, err := c.events.List(name, c.eventQueryOptions(index))
+		if c.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.log(levelError, "event", name, "error", errors.Wrap(err, "list events"))
+			select {
+			case <-time.After(c.opts.refreshPeriod):
+				continue
+			case <-c.ctx.Done():
+				return
+			}
+		}
+		index = meta.LastIndex
+		for _, event := range events {
+			if event.Name == name && event.LTime > lastTime {
+				fn(event.Payload)
+			}
+		}
+		if t := lastEventTime(events); t > lastTime {
+			lastTime = t
+		}
+	}
+}
+
+func (c *Client) eventQueryOptions(waitIndex uint64) *consulapi.QueryOptions {
+	q := &consulapi.QueryOptions{Datacenter: c.opts.datacenter, WaitIndex: waitIndex, WaitTime: c.opts.waitTime}
+	return q.WithContext(c.ctx)
+}
+
+func lastEventTime(events []*consulapi.UserEvent) uint64 {
+	var last uint64
+	for _, event := range events {
+		if event.LTime > last {
+			last = event.LTime
+		}
+	}
+	return last
+}
@@ -0,0 +1,100 @@
+package consul
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// testEvents keeps fired events in memory, its index is the number of events.
+type testEvents struct {
+	events  []*consulapi.UserEvent
+	changed chan struct{}
+	lock    sync.Mutex
+}
+
+func newTestEvents() *testEvents {
+	return &testEvents{changed: make(chan struct{})}
+}
+
+func (e *testEvents) Fire(params *consulapi.UserEvent, _ *consulapi.WriteOptions) (string, *consulapi.WriteMeta, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	event := *params
+	event.LTime = uint64(len(e.events) + 1)
+	e.events = append(e.events, &event)
+	close(e.changed)
+	e.changed = make(chan struct{})
+	return event.ID, &consulapi.WriteMeta{}, nil
+}
+
+func (e *testEvents) List(name string, q *consulapi.QueryOptions) ([]*consulapi.UserEvent, *consulapi.QueryMeta, error) {
+	for {
+		e.lock.Lock()
+		index, changed := uint64(len(e.events)), e.changed
+		if q.WaitIndex == 0 || q.WaitIndex != index {
+			var events []*consulapi.UserEvent
+			for _, event := range e.events {
+				if event.Name == name {
+					events = append(events, event)
+				}
+			}
+			e.lock.Unlock()
+			return events, &consulapi.QueryMeta{LastIndex: index}, nil
+		}
+		e.lock.Unlock()
+		select {
+		case <-changed:
+		case <-q.Context().Done():
+			return nil, nil, q.Context().Err()
+		}
+	}
+}
+
+func TestClient_SubscribeEvent(t *testing.T) {
+	c := newTestClient(t, testKV{})
+	if err := c.PublishEvent("deploy", nil); err != ErrNotSupported {
+		t.Errorf("got %v without Consul client", err)
+	}
+	c.events = newTestEvents()
+	if err := c.PublishEvent("deploy", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	payloads := make(chan string, 10)
+	err := c.SubscribeEvent("deploy", func(payload []byte) {
+		payloads <- string(payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive := func(expected string) {
+		t.Helper()
+		select {
+		case payload := <-payloads:
+			if payload != expected {
+				t.Errorf("got %q, expected %q", payload, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q is not delivered", expected)
+		}
+	}
+	for _, event := range []struct{ name, payload string }{{"deploy", "v2"}, {"restart", "api"}, {"deploy", "v3"}} {
+		if err := c.PublishEvent(event.name, []byte(event.payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive("v2")
+	receive("v3")
+	if err := c.PublishEvent("deploy", []byte("v4")); err != nil {
+		t.Fatal(err)
+	}
+	receive("v4")
+	c.Stop()
+	select {
+	case payload := <-payloads:
+		t.Errorf("unexpected %q", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,127 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExportJSON loads i from parent like PullWithDefaults and returns it as JSON object,
+// where names are Consul key names relative to parent, so nested structures and maps are nested objects.
+// Numbers, booleans and strings keep their JSON types, slices are arrays,
+// other values are strings in the form they are stored in Consul.
+// Values of fields with sensitive tag option are redacted.
+func (c *Client) ExportJSON(parent string, i interface{}) ([]byte, error) {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("i is not a pointer to structure")
+	}
+	if err := c.PullWithDefaults(parent, i); err != nil {
+		return nil, err
+	}
+	tree := map[string]interface{}{}
+	if err := c.exportStruct(parent, v.Elem(), tree); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// exportStruct puts fields of v to tree by their key names relative to consulPath.
+func (c *Client) exportStruct(consulPath string, v reflect.Value, tree map[string]interface{}) error {
+	for i, n := 0, v.NumField(); i < n; i++ {
+		fieldType := v.Type().Field(i)
+		opts := makeTagOpts(fieldType.Tag.Get("consul"))
+		if fieldType.PkgPath != "" || opts.Skip {
+			continue
+		}
+		fieldPath := c.makeConsulPath(consulPath, fieldType)
+		if fieldPath == consulPath {
+			// Inlined structure.
+			if err := c.exportStruct(consulPath, v.Field(i), tree); err != nil {
+				return err
+			}
+			continue
+		}
+		value, err := c.exportValue(fieldPath, v.Field(i), opts)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			continue
+		}
+		name := fieldPath
+		if parent := path.Clean(consulPath); parent != "." {
+			name = strings.TrimPrefix(fieldPath, parent+"/")
+		}
+		// Names with slashes are nested objects.
+		names := strings.Split(name, "/")
+		node := tree
+		for _, name := range names[:len(names)-1] {
+			child, ok := node[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[name] = child
+			}
+			node = child
+		}
+		node[names[len(names)-1]] = value
+	}
+	return nil
+}
+
+func (c *Client) exportValue(consulPath string, v reflect.Value, opts tagOpts) (interface{}, error) {
+	if opts.Sensitive {
+		return redacted, nil
+	}
+	if _, ok := wellKnowTypeParsers[v.Type()]; !ok {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() {
+				return nil, nil
+			}
+			return c.exportValue(consulPath, v.Elem(), opts)
+		case reflect.Interface:
+			return v.Interface(), nil
+		case reflect.Struct:
+			tree := map[string]interface{}{}
+			return tree, c.exportStruct(consulPath, v, tree)
+		case reflect.Map:
+			tree := make(map[string]interface{}, v.Len())
+			for _, key := range v.MapKeys() {
+				value, err := c.exportValue(consulPath+"/"+key.String(), v.MapIndex(key), tagOpts{})
+				if err != nil {
+					return nil, err
+				}
+				tree[key.String()] = value
+			}
+			return tree, nil
+		case reflect.Slice:
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				break
+			}
+			items := make([]interface{}, v.Len())
+			for i := range items {
+				item, err := c.exportValue(consulPath, v.Index(i), tagOpts{Base: opts.Base})
+				if err != nil {
+					return nil, errors.Wrapf(err, "element %d", i)
+				}
+				items[i] = item
+			}
+			return items, nil
+		case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if _, ok := stringifiers[v.Type()]; !ok && opts.Base == nil {
+				return v.Interface(), nil
+			}
+		}
+	}
+	s, err := stringifyValue(v, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "stringify value for path '%s'", consulPath)
+	}
+	return s, nil
+}
@@ -0,0 +1,65 @@
+package consul
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient_ExportJSON(t *testing.T) {
+	type dbConfig struct {
+		Host     string `consul:"default:localhost"`
+		Port     uint16 `consul:"default:5432"`
+		Password string `consul:"sensitive;default:secret"`
+	}
+	type testStruct struct {
+		Name     string        `consul:"default:api"`
+		Enabled  bool          `consul:"default:true"`
+		Workers  int           `consul:"default:4"`
+		Ratio    float64       `consul:"default:0.5"`
+		Timeout  time.Duration `consul:"default:5s"`
+		Hosts    []string      `consul:"default:a,b"`
+		Mode     Int           `consul:"name:settings/mode;default:2"`
+		Database dbConfig      `consul:"name:database"`
+		Replica  *dbConfig
+		Labels   map[string]string `consul:"default:team=core"`
+	}
+	kv := testKV{"service/database/host": []byte("db.local")}
+	c := newTestClient(t, kv)
+	data, err := c.ExportJSON("service", &testStruct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	database := map[string]interface{}{"host": "db.local", "port": 5432.0, "password": "[REDACTED]"}
+	expected := map[string]interface{}{
+		"name":     "api",
+		"enabled":  true,
+		"workers":  4.0,
+		"ratio":    0.5,
+		"timeout":  "5s",
+		"hosts":    []interface{}{"a", "b"},
+		"settings": map[string]interface{}{"mode": "2"},
+		"database": database,
+		"replica":  map[string]interface{}{"host": "localhost", "port": 5432.0, "password": "[REDACTED]"},
+		"labels":   map[string]interface{}{"team": "core"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %s", data)
+	}
+	if len(kv) != 1 {
+		t.Errorf("values are written to KV: %v", kv)
+	}
+
+	data, err = c.ExportJSON("", &dbConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"host":"localhost","password":"[REDACTED]","port":5432}` {
+		t.Errorf("got %s", data)
+	}
+}
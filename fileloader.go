@@ -0,0 +1,138 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// LoadStructFromFile loads i from JSON or TOML file like PullWithDefaults loads it from Consul,
+// so it may be used as a fallback when Consul is not available.
+// Format is detected from the file extension: .json or .toml.
+// Keys of the file are names of Consul keys relative to parent, nested objects are nested paths,
+// e.g. {"database": {"host": "localhost"}} is the value of key parent/database/host.
+// Arrays are joined with the separator of their fields and integers are written in the base of their fields,
+// so values are parsed the same way as values of Consul keys.
+// Options opts are applied to the client, e.g. WithJSONTagFallback.
+func LoadStructFromFile(parent string, filename string, i interface{}, opts ...Option) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var tree map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return errors.Wrapf(err, "decode '%s'", filename)
+		}
+	case ".toml":
+		t, err := toml.LoadBytes(data)
+		if err != nil {
+			return errors.Wrapf(err, "decode '%s'", filename)
+		}
+		tree = t.ToMap()
+	default:
+		return errors.Errorf("unknown format of '%s'", filename)
+	}
+	c, err := newOfflineClient(opts...)
+	if err != nil {
+		return err
+	}
+	defer c.Stop()
+	fields := map[string]tagOpts{}
+	c.fieldOpts(parent, reflect.TypeOf(i), map[reflect.Type]bool{}, fields)
+	kv := map[string]string{}
+	if err := flattenFile(parent, tree, fields, kv); err != nil {
+		return errors.Wrapf(err, "load '%s'", filename)
+	}
+	return UnmarshalConsul(parent, kv, i, opts...)
+}
+
+// fieldOpts puts tag options of all fields of t to fields by their paths under consulPath.
+func (c *Client) fieldOpts(consulPath string, t reflect.Type, visited map[reflect.Type]bool, fields map[string]tagOpts) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if _, ok := wellKnowTypeParsers[t]; ok || t.Kind() != reflect.Struct || visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+	for i, n := 0, t.NumField(); i < n; i++ {
+		fieldType := t.Field(i)
+		opts := makeTagOpts(fieldType.Tag.Get("consul"))
+		if fieldType.PkgPath != "" || opts.Skip {
+			continue
+		}
+		fieldPath := c.makeConsulPath(consulPath, fieldType)
+		if fieldPath != consulPath {
+			fields[fieldPath] = opts
+		}
+		if !opts.Flatten {
+			c.fieldOpts(fieldPath, fieldType.Type, visited, fields)
+		}
+	}
+}
+
+// flattenFile puts all values of tree to kv by their paths under prefix,
+// formatted according to tag options of their fields.
+func flattenFile(prefix string, tree map[string]interface{}, fields map[string]tagOpts, kv map[string]string) error {
+	for key, value := range tree {
+		keyPath := path.Join(prefix, key)
+		if nested, ok := value.(map[string]interface{}); ok {
+			if err := flattenFile(keyPath, nested, fields, kv); err != nil {
+				return err
+			}
+			continue
+		}
+		s, err := fileValue(value, fields[keyPath])
+		if err != nil {
+			return errors.Wrapf(err, "key '%s'", keyPath)
+		}
+		kv[keyPath] = s
+	}
+	return nil
+}
+
+func fileValue(value interface{}, opts tagOpts) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return strconv.FormatInt(n, opts.formatBase()), nil
+		}
+		return v.String(), nil
+	case int64:
+		return strconv.FormatInt(v, opts.formatBase()), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i := range v {
+			s, err := fileValue(v[i], tagOpts{Base: opts.Base})
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, opts.separator()), nil
+	case map[string]interface{}, []map[string]interface{}:
+		return "", errors.New("objects in arrays are not supported")
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,138 @@
+package consul
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadStructFromFile(t *testing.T) {
+	type testStruct struct {
+		Name     string
+		Enabled  bool
+		Retries  int `consul:"default:3"`
+		Ratio    float64
+		Timeout  time.Duration
+		Hosts    []string
+		Database struct {
+			Host string `consul:"default:localhost"`
+			Port int
+		} `consul:"name:database"`
+		Labels map[string]string
+	}
+	files := map[string]string{
+		"config.json": `{
+			"name": "api",
+			"enabled": true,
+			"ratio": 0.5,
+			"timeout": "5s",
+			"hosts": ["a", "b"],
+			"database": {"port": 5432},
+			"labels": {"team": "core"}
+		}`,
+		"config.toml": `
+name = "api"
+enabled = true
+ratio = 0.5
+timeout = "5s"
+hosts = ["a", "b"]
+
+[database]
+port = 5432
+
+[labels]
+team = "core"
+`,
+	}
+
+	kv := NewMemoryKV()
+	kv.Load(map[string][]byte{
+		"service/name":          []byte("api"),
+		"service/enabled":       []byte("true"),
+		"service/ratio":         []byte("0.5"),
+		"service/timeout":       []byte("5s"),
+		"service/hosts":         []byte("a,b"),
+		"service/database/port": []byte("5432"),
+		"service/labels/team":   []byte("core"),
+	})
+	c := newTestClient(t, kv)
+	var expected testStruct
+	if err := c.PullWithDefaults("service", &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var config testStruct
+		if err := LoadStructFromFile("service", filename, &config); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(config, expected) {
+			t.Errorf("%s: got %+v, expected %+v", name, config, expected)
+		}
+	}
+
+	filename := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(filename, []byte("name: api"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadStructFromFile("service", filename, &testStruct{}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestLoadStructFromFile_TagOptions(t *testing.T) {
+	type testStruct struct {
+		Hosts []string `consul:"sep:|"`
+		Ports []int    `consul:"sep: ;base:8"`
+		Mask  uint32   `consul:"base:16"`
+	}
+	kv := NewMemoryKV()
+	kv.Load(map[string][]byte{
+		"service/hosts": []byte("a,b|c"),
+		"service/ports": []byte("120 673"),
+		"service/mask":  []byte("ff00"),
+	})
+	c := newTestClient(t, kv)
+	var expected testStruct
+	if err := c.PullOrPush("service", &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "config.json")
+	content := `{"hosts": ["a,b", "c"], "ports": [80, 443], "mask": 65280}`
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var config testStruct
+	if err := LoadStructFromFile("service", filename, &config); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("got %+v, expected %+v", config, expected)
+	}
+}
+
+func TestLoadStructFromFile_RecursiveType(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`{"name": "first", "next": {"name": "second"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list := node{Next: &node{}}
+	if err := LoadStructFromFile("list", filename, &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "first" || list.Next.Name != "second" || list.Next.Next != nil {
+		t.Errorf("got %+v, next %+v", list, list.Next)
+	}
+}
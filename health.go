@@ -0,0 +1,51 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// healthcheckTimeout bounds Healthy and HealthHandler checks.
+const healthcheckTimeout = 5 * time.Second
+
+// Healthcheck returns nil if Consul is reachable: the local agent responds,
+// or, when KV is set with SetKV, KV responds to a read.
+// The check is interrupted when ctx is done, unless KV set with SetKV does not implement ContextKV.
+func (c *Client) Healthcheck(ctx context.Context) error {
+	if c.consul != nil {
+		var self map[string]map[string]interface{}
+		if _, err := c.consul.Raw().Query("/v1/agent/self", &self, (&consulapi.QueryOptions{}).WithContext(ctx)); err != nil {
+			return errors.Wrap(err, "consul agent is unreachable")
+		}
+		return nil
+	}
+	if _, err := c.get(ctx, ""); err != nil {
+		return errors.Wrap(err, "consul KV is unreachable")
+	}
+	return nil
+}
+
+// Healthy calls Healthcheck with timeout and reports whether it succeeded.
+func (c *Client) Healthy() bool {
+	ctx, cancel := context.WithTimeout(c.ctx, healthcheckTimeout)
+	defer cancel()
+	return c.Healthcheck(ctx) == nil
+}
+
+// HealthHandler returns HTTP handler, e.g. for readiness probe, which responds
+// with 200 OK if Consul is reachable and 503 Service Unavailable with the error otherwise.
+func (c *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthcheckTimeout)
+		defer cancel()
+		if err := c.Healthcheck(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
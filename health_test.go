@@ -0,0 +1,95 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// blockingKV blocks reads until unblock is closed or context is done.
+type blockingKV struct {
+	KV
+	unblock chan struct{}
+}
+
+func (kv blockingKV) GetWithContext(ctx context.Context, path string) ([]byte, error) {
+	select {
+	case <-kv.unblock:
+		return kv.KV.Get(path)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (kv blockingKV) PutWithContext(_ context.Context, path string, value []byte) error {
+	return kv.KV.Put(path, value)
+}
+
+func TestClient_Healthcheck(t *testing.T) {
+	var status int
+	canceled := make(chan struct{}, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/agent/self" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		if status == 0 {
+			// Hangs until the client gives up the request.
+			<-r.Context().Done()
+			canceled <- struct{}{}
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"Config": {"NodeName": "node-1"}}`))
+	}))
+	defer s.Close()
+	c, err := NewClient(WithConsulConfig(&consulapi.Config{Address: s.URL}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = http.StatusOK
+	if err := c.Healthcheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Healthy() {
+		t.Error("expected healthy client")
+	}
+
+	status = http.StatusInternalServerError
+	if err := c.Healthcheck(context.Background()); err == nil {
+		t.Error("expected error for failing agent")
+	}
+	recorder := httptest.NewRecorder()
+	c.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d", recorder.Code)
+	}
+
+	status = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Healthcheck(ctx); err == nil {
+		t.Error("expected error for hanging agent")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("request to agent is not canceled")
+	}
+
+	kv := blockingKV{KV: testKV{}, unblock: make(chan struct{})}
+	c = newTestClient(t, kv)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Healthcheck(ctx); errors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	close(kv.unblock)
+	if err := c.Healthcheck(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
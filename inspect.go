@@ -0,0 +1,67 @@
+package consul
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ConsulPath returns sorted full paths of all keys which PullOrPush reads or writes
+// for structure i under parent.
+// Maps are returned as their prefixes with trailing slash, as their entries are keys under it.
+// It does not connect to Consul. Options opts are applied to the client, e.g. WithPathNormalizer.
+func ConsulPath(parent string, i interface{}, opts ...Option) ([]string, error) {
+	c, err := newOfflineClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Stop()
+	return c.ConsulPath(parent, i)
+}
+
+// ConsulPath is like package ConsulPath, but uses options of the client, e.g. normalizer.
+func (c *Client) ConsulPath(parent string, i interface{}) ([]string, error) {
+	t := reflect.TypeOf(i)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("i is not a structure")
+	}
+	var paths []string
+	c.structPaths(parent, t, map[reflect.Type]bool{}, &paths)
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (c *Client) structPaths(consulPath string, t reflect.Type, visited map[reflect.Type]bool, paths *[]string) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+	for i, n := 0, t.NumField(); i < n; i++ {
+		fieldType := t.Field(i)
+		opts := makeTagOpts(fieldType.Tag.Get("consul"))
+		if fieldType.PkgPath != "" || opts.Skip {
+			continue
+		}
+		fieldPath := c.makeConsulPath(consulPath, fieldType)
+		ft := fieldType.Type
+		if _, ok := wellKnowTypeParsers[ft]; !ok && ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// Flatten values are stored in a single key.
+		_, wellKnown := wellKnowTypeParsers[ft]
+		wellKnown = wellKnown || opts.Flatten
+		switch {
+		case !wellKnown && ft.Kind() == reflect.Struct:
+			c.structPaths(fieldPath, ft, visited, paths)
+		case !wellKnown && ft.Kind() == reflect.Map:
+			*paths = append(*paths, fieldPath+"/")
+		default:
+			*paths = append(*paths, fieldPath)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConsulPath(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	type testStruct struct {
+		Name    string `consul:"name:service_name;default:api"`
+		Timeout time.Duration
+		Storage struct {
+			Host string `consul:"default:localhost"`
+		}
+		Replica *struct {
+			Host string
+		}
+		Labels map[string]string
+		Chain  node
+		Hidden string `consul:"-"`
+		hidden string
+	}
+	paths, err := ConsulPath("service", &testStruct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"service/chain/name",
+		"service/labels/",
+		"service/replica/host",
+		"service/service_name",
+		"service/storage/host",
+		"service/timeout",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got %v", paths)
+	}
+	if _, err := ConsulPath("service", "string"); err == nil {
+		t.Error("expected error for non-structure")
+	}
+}
@@ -0,0 +1,458 @@
+package consul
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// NewRetryKV returns KV which retries calls to inner failed with server or network errors
+// up to maxAttempts times, waiting backoff between attempts. Other errors, like ACL denials
+// or ErrNotSupported, are returned at once, as retries do not change them. It wraps only methods of KV, so optional interfaces
+// of the inner KV, like ContextKV or IndexedKV, are not available through it:
+// use WithRetry to retry calls to Consul.
+func NewRetryKV(inner KV, maxAttempts int, backoff time.Duration) KV {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return retryKV{inner: inner, maxAttempts: maxAttempts, backoff: backoff}
+}
+
+type retryKV struct {
+	inner       KV
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func (kv retryKV) do(fn func() error) (err error) {
+	for i := 0; i < kv.maxAttempts; i++ {
+		if i > 0 {
+			time.Sleep(kv.backoff)
+		}
+		if err = fn(); err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (kv retryKV) Get(path string) (value []byte, err error) {
+	err = kv.do(func() (err error) {
+		value, err = kv.inner.Get(path)
+		return err
+	})
+	return value, err
+}
+
+func (kv retryKV) Put(path string, value []byte) error {
+	return kv.do(func() error {
+		return kv.inner.Put(path, value)
+	})
+}
+
+func (kv retryKV) Delete(path string) error {
+	return kv.do(func() error {
+		return kv.inner.Delete(path)
+	})
+}
+
+func (kv retryKV) DeleteTree(prefix string) error {
+	return kv.do(func() error {
+		return kv.inner.DeleteTree(prefix)
+	})
+}
+
+func (kv retryKV) Keys(prefix string) (keys []string, err error) {
+	err = kv.do(func() (err error) {
+		keys, err = kv.inner.Keys(prefix)
+		return err
+	})
+	return keys, err
+}
+
+func (kv retryKV) CAS(path string, value []byte, index uint64) (ok bool, err error) {
+	err = kv.do(func() (err error) {
+		ok, err = kv.inner.CAS(path, value, index)
+		return err
+	})
+	return ok, err
+}
+
+// isRetryable reports whether err may be transient: network errors and 5xx responses of Consul.
+// Other responses, e.g. 403 on ACL denial, are not retried.
+func isRetryable(err error) bool {
+	var status consulapi.StatusError
+	if errors.As(err, &status) {
+		return status.Code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryBackoff returns delay before retry after attempt, which is backoff doubled
+// for each previous attempt with ±10% jitter.
+func retryBackoff(backoff time.Duration, attempt int) time.Duration {
+	d := backoff << uint(attempt)
+	return time.Duration(float64(d) * (0.9 + 0.2*rand.Float64()))
+}
+
+// NewLoggingKV returns KV which logs every call to inner with its duration and error.
+// Like NewHookedKV, it keeps optional interfaces of inner available to the client.
+func NewLoggingKV(inner KV, logger Logger) KV {
+	return NewHookedKV(inner, func(ctx context.Context, op, path string, call func(context.Context) error) error {
+		begin := time.Now()
+		err := call(ctx)
+		_ = logger.Log("op", op, "path", path, "took", time.Since(begin), "error", err)
+		return err
+	})
+}
+
+// NewMetricsKV returns KV which reports duration and error of every call to inner.
+// onGet is called for reads (Get, Keys, GetPair, GetMeta) and onPut for writes
+// (Put, CAS, Delete, DeleteTree, Txn and lock calls). Blocking queries of watches
+// are not reported, as their duration is the time until the value changes.
+// Nil callbacks are ignored. Like NewHookedKV, it keeps optional interfaces of inner available to the client.
+func NewMetricsKV(inner KV, onGet func(duration time.Duration, err error), onPut func(duration time.Duration, err error)) KV {
+	return NewHookedKV(inner, func(ctx context.Context, op, path string, call func(context.Context) error) error {
+		begin := time.Now()
+		err := call(ctx)
+		var report func(duration time.Duration, err error)
+		switch op {
+		case "get_with_index", "wait_tree":
+		case "get", "get_pair", "get_meta", "keys":
+			report = onGet
+		default:
+			report = onPut
+		}
+		if report != nil {
+			report(time.Since(begin), err)
+		}
+		return err
+	})
+}
+
+// NewChainedKV returns KV which reads from sources in order and returns the first non-empty value.
+// Sources which fail are skipped, the last error is returned only if all sources fail.
+// Wrap sources with NewLoggingKV to log their failures.
+// Writes go to all sources in order, the first error is returned after all of them are tried.
+// CAS goes to the first source only, as modify indices of different sources are not related.
+func NewChainedKV(sources ...KV) KV {
+	return chainedKV{sources: sources}
+}
+
+type chainedKV struct {
+	sources []KV
+}
+
+func (kv chainedKV) Get(path string) ([]byte, error) {
+	var lastErr error
+	failed := 0
+	for _, source := range kv.sources {
+		value, err := source.Get(path)
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		if len(value) != 0 {
+			return value, nil
+		}
+	}
+	if failed == len(kv.sources) {
+		return nil, lastErr
+	}
+	return nil, nil
+}
+
+// write calls fn for all sources and returns the first error.
+func (kv chainedKV) write(fn func(source KV) error) error {
+	var firstErr error
+	for _, source := range kv.sources {
+		if err := fn(source); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (kv chainedKV) Put(path string, value []byte) error {
+	return kv.write(func(source KV) error {
+		return source.Put(path, value)
+	})
+}
+
+func (kv chainedKV) Delete(path string) error {
+	return kv.write(func(source KV) error {
+		return source.Delete(path)
+	})
+}
+
+func (kv chainedKV) DeleteTree(prefix string) error {
+	return kv.write(func(source KV) error {
+		return source.DeleteTree(prefix)
+	})
+}
+
+// Keys returns sorted union of keys from all sources which did not fail.
+func (kv chainedKV) Keys(prefix string) ([]string, error) {
+	var lastErr error
+	failed := 0
+	unique := map[string]bool{}
+	for _, source := range kv.sources {
+		keys, err := source.Keys(prefix)
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		for _, key := range keys {
+			unique[key] = true
+		}
+	}
+	if failed == len(kv.sources) && failed != 0 {
+		return nil, lastErr
+	}
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (kv chainedKV) CAS(path string, value []byte, index uint64) (bool, error) {
+	if len(kv.sources) == 0 {
+		return false, nil
+	}
+	return kv.sources[0].CAS(path, value, index)
+}
+
+// KVHook is called by KV made with NewHookedKV for every call to the wrapped KV.
+// op is the name of the called method in snake case, e.g. get, get_with_index or txn,
+// calls with context are named like ones without it, e.g. GetWithContext is get,
+// path is the key or prefix of the call, it is empty for sessions and transactions.
+// The hook must call call with ctx or a context derived from it and return its error,
+// ctx is context.Background() for methods without context.
+type KVHook func(ctx context.Context, op, path string, call func(ctx context.Context) error) error
+
+// NewHookedKV returns KV which passes every call to inner through hook,
+// including calls of optional interfaces, like IndexedKV or TxnKV.
+// The returned KV has methods of all optional interfaces, but the client uses only
+// the ones inner implements, so wrapping does not switch off blocking queries or transactions.
+// Methods which inner does not implement return ErrNotSupported, except for ContextKV,
+// which is always supported: calls with context go to Get and Put of inner,
+// so the hook gets the context of the caller anyway.
+func NewHookedKV(inner KV, hook KVHook) KV {
+	return hookedKV{inner: inner, hook: hook}
+}
+
+type hookedKV struct {
+	inner KV
+	hook  KVHook
+}
+
+var contextKVType = reflect.TypeOf((*ContextKV)(nil)).Elem()
+
+func (kv hookedKV) supportsKV(t reflect.Type) bool {
+	return t == contextKVType || supportsKV(kv.inner, t)
+}
+
+// Datacenter returns datacenter of inner KV, if it has one.
+func (kv hookedKV) Datacenter() string {
+	if d, ok := kv.inner.(interface{ Datacenter() string }); ok {
+		return d.Datacenter()
+	}
+	return ""
+}
+
+func (kv hookedKV) Get(path string) (value []byte, err error) {
+	err = kv.hook(context.Background(), "get", path, func(context.Context) (err error) {
+		value, err = kv.inner.Get(path)
+		return err
+	})
+	return value, err
+}
+
+func (kv hookedKV) Put(path string, value []byte) error {
+	return kv.hook(context.Background(), "put", path, func(context.Context) error {
+		return kv.inner.Put(path, value)
+	})
+}
+
+func (kv hookedKV) Delete(path string) error {
+	return kv.hook(context.Background(), "delete", path, func(context.Context) error {
+		return kv.inner.Delete(path)
+	})
+}
+
+func (kv hookedKV) DeleteTree(prefix string) error {
+	return kv.hook(context.Background(), "delete_tree", prefix, func(context.Context) error {
+		return kv.inner.DeleteTree(prefix)
+	})
+}
+
+func (kv hookedKV) Keys(prefix string) (keys []string, err error) {
+	err = kv.hook(context.Background(), "keys", prefix, func(context.Context) (err error) {
+		keys, err = kv.inner.Keys(prefix)
+		return err
+	})
+	return keys, err
+}
+
+func (kv hookedKV) CAS(path string, value []byte, index uint64) (ok bool, err error) {
+	err = kv.hook(context.Background(), "cas", path, func(context.Context) (err error) {
+		ok, err = kv.inner.CAS(path, value, index)
+		return err
+	})
+	return ok, err
+}
+
+func (kv hookedKV) GetWithContext(ctx context.Context, path string) (value []byte, err error) {
+	err = kv.hook(ctx, "get", path, func(ctx context.Context) (err error) {
+		var inner ContextKV
+		if asKV(kv.inner, &inner) {
+			value, err = inner.GetWithContext(ctx, path)
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		value, err = kv.inner.Get(path)
+		return err
+	})
+	return value, err
+}
+
+func (kv hookedKV) PutWithContext(ctx context.Context, path string, value []byte) error {
+	return kv.hook(ctx, "put", path, func(ctx context.Context) error {
+		var inner ContextKV
+		if asKV(kv.inner, &inner) {
+			return inner.PutWithContext(ctx, path, value)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return kv.inner.Put(path, value)
+	})
+}
+
+func (kv hookedKV) GetPair(ctx context.Context, path string) (value []byte, meta KVMeta, err error) {
+	inner, ok := kv.inner.(PairKV)
+	if !ok {
+		return nil, KVMeta{}, ErrNotSupported
+	}
+	err = kv.hook(ctx, "get_pair", path, func(ctx context.Context) (err error) {
+		value, meta, err = inner.GetPair(ctx, path)
+		return err
+	})
+	return value, meta, err
+}
+
+func (kv hookedKV) GetMeta(path string) (meta KVMeta, err error) {
+	inner, ok := kv.inner.(MetaKV)
+	if !ok {
+		return KVMeta{}, ErrNotSupported
+	}
+	err = kv.hook(context.Background(), "get_meta", path, func(context.Context) (err error) {
+		meta, err = inner.GetMeta(path)
+		return err
+	})
+	return meta, err
+}
+
+func (kv hookedKV) GetWithIndex(ctx context.Context, path string, waitIndex uint64) (value []byte, index uint64, err error) {
+	inner, ok := kv.inner.(IndexedKV)
+	if !ok {
+		return nil, 0, ErrNotSupported
+	}
+	err = kv.hook(ctx, "get_with_index", path, func(ctx context.Context) (err error) {
+		value, index, err = inner.GetWithIndex(ctx, path, waitIndex)
+		return err
+	})
+	return value, index, err
+}
+
+func (kv hookedKV) WaitTree(ctx context.Context, prefix string, waitIndex uint64) (index uint64, err error) {
+	inner, ok := kv.inner.(IndexedTreeKV)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	err = kv.hook(ctx, "wait_tree", prefix, func(ctx context.Context) (err error) {
+		index, err = inner.WaitTree(ctx, prefix, waitIndex)
+		return err
+	})
+	return index, err
+}
+
+func (kv hookedKV) Txn(ops []TxnOp) error {
+	inner, ok := kv.inner.(TxnKV)
+	if !ok {
+		return ErrNotSupported
+	}
+	return kv.hook(context.Background(), "txn", "", func(context.Context) error {
+		return inner.Txn(ops)
+	})
+}
+
+func (kv hookedKV) CreateSession(ttl time.Duration) (id string, err error) {
+	inner, ok := kv.inner.(LockKV)
+	if !ok {
+		return "", ErrNotSupported
+	}
+	err = kv.hook(context.Background(), "create_session", "", func(context.Context) (err error) {
+		id, err = inner.CreateSession(ttl)
+		return err
+	})
+	return id, err
+}
+
+func (kv hookedKV) RenewSession(id string) error {
+	inner, ok := kv.inner.(LockKV)
+	if !ok {
+		return ErrNotSupported
+	}
+	return kv.hook(context.Background(), "renew_session", "", func(context.Context) error {
+		return inner.RenewSession(id)
+	})
+}
+
+func (kv hookedKV) DestroySession(id string) error {
+	inner, ok := kv.inner.(LockKV)
+	if !ok {
+		return ErrNotSupported
+	}
+	return kv.hook(context.Background(), "destroy_session", "", func(context.Context) error {
+		return inner.DestroySession(id)
+	})
+}
+
+func (kv hookedKV) Acquire(key, session string) (ok bool, err error) {
+	inner, isLockKV := kv.inner.(LockKV)
+	if !isLockKV {
+		return false, ErrNotSupported
+	}
+	err = kv.hook(context.Background(), "acquire", key, func(context.Context) (err error) {
+		ok, err = inner.Acquire(key, session)
+		return err
+	})
+	return ok, err
+}
+
+func (kv hookedKV) Release(key, session string) (ok bool, err error) {
+	inner, isLockKV := kv.inner.(LockKV)
+	if !isLockKV {
+		return false, ErrNotSupported
+	}
+	err = kv.hook(context.Background(), "release", key, func(context.Context) (err error) {
+		ok, err = inner.Release(key, session)
+		return err
+	})
+	return ok, err
+}
@@ -0,0 +1,160 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+type flakyKV struct {
+	KV
+	failures int
+	calls    int
+	// err is returned on failures, it is a retryable server error by default.
+	err error
+}
+
+func (kv *flakyKV) Get(path string) ([]byte, error) {
+	kv.calls++
+	if kv.calls <= kv.failures {
+		if kv.err != nil {
+			return nil, kv.err
+		}
+		return nil, consulapi.StatusError{Code: http.StatusServiceUnavailable, Body: "temporary error"}
+	}
+	return kv.KV.Get(path)
+}
+
+func TestRetryKV(t *testing.T) {
+	inner := &flakyKV{KV: testKV{"key": []byte("value")}, failures: 2}
+	value, err := NewRetryKV(inner, 3, time.Millisecond).Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "value" || inner.calls != 3 {
+		t.Errorf("got %q after %d calls", value, inner.calls)
+	}
+
+	inner = &flakyKV{KV: testKV{}, failures: 5}
+	if _, err := NewRetryKV(inner, 3, time.Millisecond).Get("key"); err == nil {
+		t.Error("expected error after all attempts")
+	}
+	if inner.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", inner.calls)
+	}
+
+	for _, failure := range []error{ErrNotSupported, consulapi.StatusError{Code: http.StatusForbidden, Body: "ACL not found"}} {
+		inner = &flakyKV{KV: testKV{}, failures: 5, err: failure}
+		if _, err := NewRetryKV(inner, 3, time.Millisecond).Get("key"); err != failure {
+			t.Errorf("expected %v, got %v", failure, err)
+		}
+		if inner.calls != 1 {
+			t.Errorf("%v: expected 1 call, got %d", failure, inner.calls)
+		}
+	}
+}
+
+func TestMetricsKV(t *testing.T) {
+	var gets, puts int
+	kv := NewMetricsKV(NewLoggingKV(testKV{}, nopLogger{}),
+		func(time.Duration, error) { gets++ },
+		func(time.Duration, error) { puts++ },
+	)
+	_ = kv.Put("key", []byte("value"))
+	_, _ = kv.Get("key")
+	_, _ = kv.Keys("")
+	if gets != 2 || puts != 1 {
+		t.Errorf("got %d gets and %d puts", gets, puts)
+	}
+}
+
+func TestHookedKV_OptionalInterfaces(t *testing.T) {
+	var ops []string
+	metrics := func(kv KV) KV {
+		return NewMetricsKV(kv, nil, nil)
+	}
+	hook := func(kv KV) KV {
+		return NewHookedKV(kv, func(ctx context.Context, op, path string, call func(context.Context) error) error {
+			ops = append(ops, op)
+			return call(ctx)
+		})
+	}
+	c, err := NewClient(SetKV(NewMemoryKV()), DisableWatch, WithKVMiddleware(metrics), WithKVMiddleware(hook))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexed IndexedKV
+	if !asKV(c.kv, &indexed) {
+		t.Error("IndexedKV is hidden by middlewares")
+	}
+	if err := c.Transaction([]TxnOp{SetOp("key", "value")}); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := c.GetMeta("key"); err != nil || meta.ModifyIndex == 0 {
+		t.Errorf("got %+v, %v", meta, err)
+	}
+	if len(ops) != 2 || ops[0] != "txn" || ops[1] != "get_meta" {
+		t.Errorf("got %v", ops)
+	}
+
+	c, err = NewClient(SetKV(testKV{}), DisableWatch, WithKVMiddleware(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asKV(c.kv, &indexed) {
+		t.Error("IndexedKV is not implemented by wrapped KV")
+	}
+	if err := c.Transaction([]TxnOp{SetOp("key", "value")}); err != ErrNotSupported {
+		t.Errorf("got %v", err)
+	}
+}
+
+// brokenKV fails all reads and writes.
+type brokenKV struct {
+	KV
+}
+
+func (brokenKV) Get(string) ([]byte, error) {
+	return nil, errors.New("broken")
+}
+
+func (brokenKV) Put(string, []byte) error {
+	return errors.New("broken")
+}
+
+func TestChainedKV(t *testing.T) {
+	local, remote := testKV{}, testKV{"key": []byte("remote"), "other": []byte("other")}
+	kv := NewChainedKV(local, brokenKV{}, remote)
+	value, err := kv.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "remote" {
+		t.Errorf("got %q", value)
+	}
+	local["key"] = []byte("local")
+	if value, _ := kv.Get("key"); string(value) != "local" {
+		t.Errorf("got %q", value)
+	}
+	if value, err := kv.Get("absent"); value != nil || err != nil {
+		t.Errorf("got %q, %v", value, err)
+	}
+	if _, err := NewChainedKV(brokenKV{}, brokenKV{}).Get("key"); err == nil {
+		t.Error("expected error when all sources fail")
+	}
+
+	if err := kv.Put("new", []byte("value")); err == nil {
+		t.Error("expected error of broken source")
+	}
+	if string(local["new"]) != "value" || string(remote["new"]) != "value" {
+		t.Errorf("value is not put to all sources: %q, %q", local["new"], remote["new"])
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(...interface{}) error { return nil }
@@ -0,0 +1,121 @@
+// Package kvmiddleware provides KV wrappers which change values on their way to Consul.
+package kvmiddleware
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+	"gopkg.in/devimteam/consul.v3"
+)
+
+// encryptedPrefix marks encrypted values.
+var encryptedPrefix = []byte("enc:v1:")
+
+// EncryptedKVOption configures KV made with NewEncryptedKV.
+type EncryptedKVOption func(*encryptedKV)
+
+// RequireEncryption makes KV made with NewEncryptedKV return error for values without encryption marker,
+// so anyone who can write to KV can not replace an encrypted value with a plain one.
+// Enable it after all values are put through NewEncryptedKV.
+func RequireEncryption() EncryptedKVOption {
+	return func(kv *encryptedKV) {
+		kv.requireEncryption = true
+	}
+}
+
+// NewEncryptedKV returns KV which encrypts values with AES-GCM before putting them to inner
+// and decrypts them on get. Values are stored as prefix and base64 of nonce followed by ciphertext.
+// The key path is authenticated with the value, so a value copied to another key can not be decrypted.
+// Values without encryption marker, e.g. ones which were put before encryption was enabled,
+// are returned as is, unless RequireEncryption is set.
+func NewEncryptedKV(inner consul.KV, key [32]byte, opts ...EncryptedKVOption) consul.KV {
+	// Errors are not possible for AES-256 key and AES block size.
+	block, _ := aes.NewCipher(key[:])
+	gcm, _ := cipher.NewGCM(block)
+	kv := encryptedKV{inner: inner, gcm: gcm}
+	for _, opt := range opts {
+		opt(&kv)
+	}
+	return kv
+}
+
+type encryptedKV struct {
+	inner             consul.KV
+	gcm               cipher.AEAD
+	requireEncryption bool
+}
+
+func (kv encryptedKV) encrypt(path string, value []byte) ([]byte, error) {
+	nonce := make([]byte, kv.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := kv.gcm.Seal(nonce, nonce, value, []byte(path))
+	encoded := make([]byte, len(encryptedPrefix)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(encoded, encryptedPrefix)
+	base64.StdEncoding.Encode(encoded[len(encryptedPrefix):], sealed)
+	return encoded, nil
+}
+
+func (kv encryptedKV) decrypt(path string, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, encryptedPrefix) {
+		if kv.requireEncryption {
+			return nil, errors.Errorf("value of '%s' is not encrypted", path)
+		}
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(value[len(encryptedPrefix):]))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode encrypted value")
+	}
+	if len(sealed) < kv.gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	nonce, ciphertext := sealed[:kv.gcm.NonceSize()], sealed[kv.gcm.NonceSize():]
+	plain, err := kv.gcm.Open(nil, nonce, ciphertext, []byte(path))
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt value")
+	}
+	return plain, nil
+}
+
+func (kv encryptedKV) Get(path string) ([]byte, error) {
+	value, err := kv.inner.Get(path)
+	if err != nil || len(value) == 0 {
+		return value, err
+	}
+	return kv.decrypt(path, value)
+}
+
+func (kv encryptedKV) Put(path string, value []byte) error {
+	encrypted, err := kv.encrypt(path, value)
+	if err != nil {
+		return err
+	}
+	return kv.inner.Put(path, encrypted)
+}
+
+func (kv encryptedKV) CAS(path string, value []byte, index uint64) (bool, error) {
+	encrypted, err := kv.encrypt(path, value)
+	if err != nil {
+		return false, err
+	}
+	return kv.inner.CAS(path, encrypted, index)
+}
+
+func (kv encryptedKV) Delete(path string) error {
+	return kv.inner.Delete(path)
+}
+
+func (kv encryptedKV) DeleteTree(prefix string) error {
+	return kv.inner.DeleteTree(prefix)
+}
+
+func (kv encryptedKV) Keys(prefix string) ([]string, error) {
+	return kv.inner.Keys(prefix)
+}
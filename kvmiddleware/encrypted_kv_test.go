@@ -0,0 +1,54 @@
+package kvmiddleware
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/devimteam/consul.v3"
+)
+
+func TestEncryptedKV(t *testing.T) {
+	inner := consul.NewMemoryKV()
+	inner.Load(map[string][]byte{"plain": []byte("old value")})
+	kv := NewEncryptedKV(inner, [32]byte{1, 2, 3})
+	if err := kv.Put("secret", []byte("password")); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := inner.Get("secret")
+	if bytes.Contains(stored, []byte("password")) {
+		t.Errorf("value is stored in plain text: %q", stored)
+	}
+	value, err := kv.Get("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "password" {
+		t.Errorf("got %q", value)
+	}
+	value, err = kv.Get("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "old value" {
+		t.Errorf("got %q", value)
+	}
+	if _, err := NewEncryptedKV(inner, [32]byte{1, 2, 3}, RequireEncryption()).Get("plain"); err == nil {
+		t.Error("expected error on plain value with RequireEncryption")
+	}
+
+	_ = inner.Put("other", stored)
+	if _, err := kv.Get("other"); err == nil {
+		t.Error("expected error on value copied from another key")
+	}
+
+	tampered := append([]byte(nil), stored...)
+	tampered[len(tampered)-3] ^= 1
+	_ = inner.Put("secret", tampered)
+	if _, err := kv.Get("secret"); err == nil {
+		t.Error("expected error on tampered value")
+	}
+	_ = inner.Put("secret", stored)
+	if _, err := NewEncryptedKV(inner, [32]byte{4}).Get("secret"); err == nil {
+		t.Error("expected error with wrong key")
+	}
+}
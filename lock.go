@@ -0,0 +1,157 @@
+package consul
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// ErrLockHeld is returned by Lock when the key is locked by another session.
+var ErrLockHeld = errors.New("lock is held by another session")
+
+// ErrSessionNotFound is returned when session is expired or destroyed.
+var ErrSessionNotFound = errors.New("session not found")
+
+// LockKV is a KV which supports session based locks.
+type LockKV interface {
+	KV
+	// CreateSession creates session which is invalidated if it is not renewed during ttl.
+	// Locks of invalidated session are released.
+	CreateSession(ttl time.Duration) (string, error)
+	RenewSession(id string) error
+	DestroySession(id string) error
+	Acquire(key, session string) (bool, error)
+	Release(key, session string) (bool, error)
+}
+
+// Lock is a distributed lock of a key, see Client.Lock.
+type Lock struct {
+	kv      LockKV
+	key     string
+	session string
+	held    int32
+	stop    func()
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+// Lock acquires lock on key, which is held until Release is called
+// or the client is stopped. It does not wait for the lock and returns ErrLockHeld
+// if the key is locked by another session. The session of the lock is renewed
+// every ttl/2, if it expires the lock is lost and IsHeld returns false.
+// It returns ErrNotSupported if KV does not implement LockKV.
+func (c *Client) Lock(key string, ttl time.Duration) (*Lock, error) {
+	return c.LockWithContext(c.ctx, key, ttl)
+}
+
+// LockWithContext is like Lock, but the lock is also released when ctx is done.
+func (c *Client) LockWithContext(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	var kv LockKV
+	if !asKV(c.kv, &kv) {
+		return nil, ErrNotSupported
+	}
+	session, err := kv.CreateSession(ttl)
+	if err != nil {
+		return nil, errors.Wrap(err, "create session")
+	}
+	acquired, err := kv.Acquire(key, session)
+	if err != nil || !acquired {
+		_ = kv.DestroySession(session)
+		if err != nil {
+			return nil, errors.Wrapf(err, "acquire '%s'", key)
+		}
+		return nil, errors.Wrapf(ErrLockHeld, "'%s'", key)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	l := &Lock{kv: kv, key: key, session: session, held: 1, stop: cancel, done: make(chan struct{})}
+	go l.renew(ctx, c, ttl/2)
+	return l, nil
+}
+
+func (l *Lock) renew(ctx context.Context, c *Client, period time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.kv.RenewSession(l.session); err != nil {
+				c.watchError(l.key, errors.Wrap(err, "renew lock session"))
+				if errors.Cause(err) == ErrSessionNotFound {
+					atomic.StoreInt32(&l.held, 0)
+					return
+				}
+			}
+		case <-ctx.Done():
+			_ = l.release()
+			return
+		}
+	}
+}
+
+// IsHeld reports whether the lock is still held.
+func (l *Lock) IsHeld() bool {
+	return atomic.LoadInt32(&l.held) == 1
+}
+
+// Release releases the lock and destroys its session.
+// It is safe to call Release several times.
+func (l *Lock) Release() error {
+	l.stop()
+	<-l.done
+	return l.release()
+}
+
+func (l *Lock) release() error {
+	l.once.Do(func() {
+		held := atomic.SwapInt32(&l.held, 0) == 1
+		if held {
+			if _, err := l.kv.Release(l.key, l.session); err != nil {
+				l.err = errors.Wrapf(err, "release '%s'", l.key)
+			}
+		}
+		if err := l.kv.DestroySession(l.session); err != nil && l.err == nil {
+			l.err = errors.Wrap(err, "destroy session")
+		}
+	})
+	return l.err
+}
+
+func (kv consulKV) CreateSession(ttl time.Duration) (string, error) {
+	id, _, err := kv.session.Create(&consulapi.SessionEntry{
+		TTL:      ttl.String(),
+		Behavior: consulapi.SessionBehaviorRelease,
+	}, kv.writeOptions(context.Background()))
+	return id, err
+}
+
+func (kv consulKV) RenewSession(id string) error {
+	entry, _, err := kv.session.Renew(id, kv.writeOptions(context.Background()))
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (kv consulKV) DestroySession(id string) error {
+	_, err := kv.session.Destroy(id, kv.writeOptions(context.Background()))
+	return err
+}
+
+func (kv consulKV) Acquire(key, session string) (bool, error) {
+	ok, _, err := kv.kv.Acquire(&consulapi.KVPair{Key: key, Session: session}, kv.writeOptions(context.Background()))
+	return ok, err
+}
+
+func (kv consulKV) Release(key, session string) (bool, error) {
+	ok, _, err := kv.kv.Release(&consulapi.KVPair{Key: key, Session: session}, kv.writeOptions(context.Background()))
+	return ok, err
+}
@@ -0,0 +1,55 @@
+package consul
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestClient_Lock(t *testing.T) {
+	s := newConsulServer(t)
+	c := s.client(t)
+	defer c.Stop()
+	lock, err := c.Lock("migrations", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lock.IsHeld() || s.holder("migrations") == "" {
+		t.Fatal("lock is not held")
+	}
+	if _, err := c.Lock("migrations", time.Second); errors.Cause(err) != ErrLockHeld {
+		t.Errorf("expected ErrLockHeld, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.lock.Lock()
+	renewals := s.renewals
+	s.lock.Unlock()
+	if renewals == 0 {
+		t.Error("session is not renewed")
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if lock.IsHeld() || s.holder("migrations") != "" {
+		t.Error("lock is not released")
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("second release: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lock, err = c.LockWithContext(ctx, "migrations", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitFor(t, func() bool {
+		return !lock.IsHeld() && s.holder("migrations") == ""
+	})
+
+	if _, err := newTestClient(t, testKV{}).Lock("migrations", time.Second); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
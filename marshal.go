@@ -0,0 +1,160 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stringifiers convert values of well known types to the form which is parsed by their parsers.
+var stringifiers = map[reflect.Type]func(v reflect.Value, opts tagOpts) (string, error){}
+
+// MarshalConsul returns values of all fields of i by their full paths under parent,
+// in the form they are loaded by PullOrPush. Map entries are returned as separate keys.
+// It does not connect to Consul. Options opts are applied to the client, e.g. WithJSONTagFallback.
+func MarshalConsul(parent string, i interface{}, opts ...Option) (map[string]string, error) {
+	c, err := newOfflineClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Stop()
+	v := reflect.Indirect(reflect.ValueOf(i))
+	if v.Kind() != reflect.Struct {
+		return nil, errors.New("i is not a structure")
+	}
+	kv := map[string]string{}
+	if err := c.marshal(parent, v, tagOpts{}, kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// UnmarshalConsul loads i from kv like PullWithDefaults loads it from Consul,
+// with the same errors for missing required keys and invalid values.
+// Keys of kv are full paths, like ones returned by MarshalConsul.
+// It does not connect to Consul, so it may be used in tests or with config files.
+// Options opts are applied to the client, e.g. WithJSONTagFallback.
+func UnmarshalConsul(parent string, kv map[string]string, i interface{}, opts ...Option) error {
+	memory := NewMemoryKV()
+	for key, value := range kv {
+		memory.set(key, []byte(value))
+	}
+	c, err := newOfflineClient(append(opts[:len(opts):len(opts)], SetKV(memory))...)
+	if err != nil {
+		return err
+	}
+	defer c.Stop()
+	return c.PullWithDefaults(parent, i)
+}
+
+func (c *Client) marshal(consulPath string, v reflect.Value, opts tagOpts, kv map[string]string) error {
+	if opts.Flatten {
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return errors.Wrapf(err, "marshal value for path '%s'", consulPath)
+		}
+		kv[consulPath] = string(data)
+		return nil
+	}
+	if _, ok := wellKnowTypeParsers[v.Type()]; !ok {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() {
+				return nil
+			}
+			return c.marshal(consulPath, v.Elem(), opts, kv)
+		case reflect.Struct:
+			for i, n := 0, v.NumField(); i < n; i++ {
+				fieldType := v.Type().Field(i)
+				fieldOpts := makeTagOpts(fieldType.Tag.Get("consul"))
+				if fieldType.PkgPath != "" || fieldOpts.Skip {
+					continue
+				}
+				if err := c.marshal(c.makeConsulPath(consulPath, fieldType), v.Field(i), fieldOpts, kv); err != nil {
+					return err
+				}
+			}
+			return nil
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return errors.Errorf("map[%s] is not supported", v.Type().Key())
+			}
+			for _, key := range v.MapKeys() {
+				entryPath := consulPath + "/" + key.String()
+				entry := v.MapIndex(key)
+				// Entries of map[string]interface{} are loaded as strings, so they are not stored as JSON.
+				if entry.Kind() == reflect.Interface && !entry.IsNil() {
+					entry = entry.Elem()
+				}
+				s, err := stringifyValue(entry, tagOpts{})
+				if err != nil {
+					return errors.Wrapf(err, "stringify value for path '%s'", entryPath)
+				}
+				kv[entryPath] = s
+			}
+			return nil
+		}
+	}
+	s, err := stringifyValue(v, opts)
+	if err != nil {
+		return errors.Wrapf(err, "stringify value for path '%s'", consulPath)
+	}
+	if opts.OmitEmpty && s == "" {
+		return nil
+	}
+	kv[consulPath] = s
+	return nil
+}
+
+// stringifyValue is the inverse of parsers: it returns the form of v which is parsed back to v.
+func stringifyValue(v reflect.Value, opts tagOpts) (string, error) {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		data, err := json.Marshal(v.Interface())
+		return string(data), err
+	}
+	if fn, ok := stringifiers[v.Type()]; ok {
+		return fn(v, opts)
+	}
+	if _, ok := wellKnowTypeParsers[v.Type()]; ok {
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			return s.String(), nil
+		}
+		return "", errors.Errorf("can not find stringifier for %s", v.Type())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), opts.formatBase()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), opts.formatBase()), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+		parts := make([]string, v.Len())
+		for i := range parts {
+			s, err := stringifyValue(v.Index(i), tagOpts{Base: opts.Base})
+			if err != nil {
+				return "", errors.Wrapf(err, "element %d", i)
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, opts.separator()), nil
+	default:
+		return "", errors.Errorf("can not find stringifier for %s", v.Type())
+	}
+}
@@ -0,0 +1,190 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshalConsul(t *testing.T) {
+	type inner struct {
+		Host string
+		Port int
+	}
+	type testStruct struct {
+		Name     string
+		Timeout  time.Duration
+		Started  time.Time `consul:"format:2006-01-02"`
+		Ratio    float64
+		Tags     []string `consul:"sep:|"`
+		Storage  inner
+		Replica  *inner
+		Missing  *inner
+		Limits   map[string]int
+		Internal string `consul:"-"`
+		Empty    string `consul:"omitempty"`
+	}
+	config := testStruct{
+		Name:     "api",
+		Timeout:  1500 * time.Millisecond,
+		Started:  time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+		Ratio:    0.25,
+		Tags:     []string{"a", "b"},
+		Storage:  inner{Host: "localhost", Port: 5432},
+		Replica:  &inner{Host: "replica", Port: 5433},
+		Limits:   map[string]int{"read": 10, "write": 5},
+		Internal: "secret",
+	}
+	kv, err := MarshalConsul("service", &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"service/name":         "api",
+		"service/timeout":      "1.5s",
+		"service/started":      "2020-02-03",
+		"service/ratio":        "0.25",
+		"service/tags":         "a|b",
+		"service/storage/host": "localhost",
+		"service/storage/port": "5432",
+		"service/replica/host": "replica",
+		"service/replica/port": "5433",
+		"service/limits/read":  "10",
+		"service/limits/write": "5",
+	}
+	if !reflect.DeepEqual(kv, expected) {
+		t.Errorf("got %v", kv)
+	}
+
+	loaded := testStruct{}
+	if err := UnmarshalConsul("service", kv, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	config.Internal, config.Missing = "", &inner{}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("got %+v", loaded)
+	}
+}
+
+func TestMarshalConsul_WatchTypes(t *testing.T) {
+	type testStruct struct {
+		Name  String
+		Hosts CSV
+		Flag  Bool
+	}
+	config := testStruct{}
+	if err := UnmarshalConsul("service", map[string]string{
+		"service/name":  "api",
+		"service/hosts": "a,b",
+		"service/flag":  "true",
+	}, &config); err != nil {
+		t.Fatal(err)
+	}
+	kv, err := MarshalConsul("service", &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"service/name": "api", "service/hosts": "a,b", "service/flag": "true"}
+	if !reflect.DeepEqual(kv, expected) {
+		t.Errorf("got %v", kv)
+	}
+}
+
+func TestUnmarshalConsul_Errors(t *testing.T) {
+	type requiredStruct struct {
+		Name string `consul:"required"`
+	}
+	type invalidStruct struct {
+		Port int
+	}
+	c, err := NewClient(SetKV(testKV{"service/port": []byte("http")}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range []interface{}{&requiredStruct{}, &invalidStruct{}} {
+		expected := c.PullOrPush("service", out)
+		got := UnmarshalConsul("service", map[string]string{"service/port": "http"}, out)
+		if expected == nil || got == nil || got.Error() != expected.Error() {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestMarshalConsul_Maps(t *testing.T) {
+	type testStruct struct {
+		Labels map[string]string
+		Ports  map[string]int
+		Flags  map[string]bool
+		Empty  map[string]int
+	}
+	in := testStruct{
+		Labels: map[string]string{"env": "prod", "team": "core"},
+		Ports:  map[string]int{"http": 80, "admin": -1},
+		Flags:  map[string]bool{"beta": true, "legacy": false},
+		Empty:  map[string]int{},
+	}
+	kv, err := MarshalConsul("service", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv["service/ports/admin"] != "-1" || kv["service/flags/legacy"] != "false" {
+		t.Errorf("got %v", kv)
+	}
+	var out testStruct
+	if err := UnmarshalConsul("service", kv, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v, expected %+v", out, in)
+	}
+}
+
+// Map entries of nested fields must be written under the full path of the field, not by bare keys.
+func TestMarshalConsul_NestedMapPaths(t *testing.T) {
+	type dbConfig struct {
+		Labels map[string]string
+	}
+	type testStruct struct {
+		Database dbConfig `consul:"name:database"`
+	}
+	data, err := MarshalConsul("service", testStruct{Database: dbConfig{Labels: map[string]string{"env": "prod"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := testKV{}
+	if err := newTestClient(t, kv).Restore("service/", data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kv, testKV{"service/database/labels/env": []byte("prod")}) {
+		t.Errorf("got %v", kv)
+	}
+}
+
+func TestMarshalConsul_Options(t *testing.T) {
+	type testStruct struct {
+		MaxConns int `json:"max_connections"`
+		Retries  int `consul:"default:3"`
+	}
+	kv, err := MarshalConsul("service", &testStruct{MaxConns: 10, Retries: 5}, WithJSONTagFallback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"service/max_connections": "10", "service/retries": "5"}
+	if !reflect.DeepEqual(kv, expected) {
+		t.Errorf("got %v, expected %v", kv, expected)
+	}
+	var config testStruct
+	if err := UnmarshalConsul("service", map[string]string{"service/max_connections": "20"}, &config, WithJSONTagFallback()); err != nil {
+		t.Fatal(err)
+	}
+	if config != (testStruct{MaxConns: 20, Retries: 3}) {
+		t.Errorf("got %+v", config)
+	}
+	paths, err := ConsulPath("service", &config, WithJSONTagFallback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{"service/max_connections", "service/retries"}) {
+		t.Errorf("got paths %v", paths)
+	}
+}
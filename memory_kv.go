@@ -0,0 +1,171 @@
+package consul
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryKV is a KV which keeps values in memory.
+// It is useful for tests and local development without Consul agent.
+// MemoryKV is safe for concurrent use.
+type MemoryKV struct {
+	lock    sync.RWMutex
+	index   uint64
+	pairs   map[string]memoryPair
+	changed chan struct{}
+}
+
+type memoryPair struct {
+	value       []byte
+	index       uint64
+	createIndex uint64
+}
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		pairs:   map[string]memoryPair{},
+		changed: make(chan struct{}),
+	}
+}
+
+// Load puts all values from data.
+func (kv *MemoryKV) Load(data map[string][]byte) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	for path, value := range data {
+		kv.set(path, value)
+	}
+}
+
+func (kv *MemoryKV) Get(path string) ([]byte, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	pair, ok := kv.pairs[path]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), pair.value...), nil
+}
+
+func (kv *MemoryKV) GetMeta(path string) (KVMeta, error) {
+	_, meta, err := kv.GetPair(context.Background(), path)
+	return meta, err
+}
+
+func (kv *MemoryKV) GetPair(_ context.Context, path string) ([]byte, KVMeta, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	pair, ok := kv.pairs[path]
+	if !ok {
+		return nil, KVMeta{}, nil
+	}
+	return append([]byte(nil), pair.value...), KVMeta{ModifyIndex: pair.index, CreateIndex: pair.createIndex}, nil
+}
+
+// GetWithIndex blocks until any value is changed after waitIndex or ctx is done.
+func (kv *MemoryKV) GetWithIndex(ctx context.Context, path string, waitIndex uint64) ([]byte, uint64, error) {
+	for {
+		kv.lock.RLock()
+		if kv.index > waitIndex {
+			value, index := append([]byte(nil), kv.pairs[path].value...), kv.index
+			kv.lock.RUnlock()
+			return value, index, nil
+		}
+		changed := kv.changed
+		kv.lock.RUnlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+}
+
+// WaitTree blocks until any value is changed after waitIndex or ctx is done.
+// It does not filter changes by prefix.
+func (kv *MemoryKV) WaitTree(ctx context.Context, _ string, waitIndex uint64) (uint64, error) {
+	for {
+		kv.lock.RLock()
+		index, changed := kv.index, kv.changed
+		kv.lock.RUnlock()
+		if index > waitIndex {
+			return index, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (kv *MemoryKV) Put(path string, value []byte) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	kv.set(path, value)
+	return nil
+}
+
+func (kv *MemoryKV) CAS(path string, value []byte, index uint64) (bool, error) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	if kv.pairs[path].index != index {
+		return false, nil
+	}
+	kv.set(path, value)
+	return true, nil
+}
+
+func (kv *MemoryKV) Delete(path string) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	if _, ok := kv.pairs[path]; ok {
+		delete(kv.pairs, path)
+		kv.notify()
+	}
+	return nil
+}
+
+func (kv *MemoryKV) DeleteTree(prefix string) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	for path := range kv.pairs {
+		if strings.HasPrefix(path, prefix) {
+			delete(kv.pairs, path)
+		}
+	}
+	kv.notify()
+	return nil
+}
+
+func (kv *MemoryKV) Keys(prefix string) ([]string, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	var keys []string
+	for path := range kv.pairs {
+		if strings.HasPrefix(path, prefix) {
+			keys = append(keys, path)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// set should be called with write lock held.
+func (kv *MemoryKV) set(path string, value []byte) {
+	kv.notify()
+	createIndex := kv.index
+	if pair, ok := kv.pairs[path]; ok {
+		createIndex = pair.createIndex
+	}
+	kv.pairs[path] = memoryPair{value: append([]byte(nil), value...), index: kv.index, createIndex: createIndex}
+}
+
+// notify should be called with write lock held.
+func (kv *MemoryKV) notify() {
+	kv.index++
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
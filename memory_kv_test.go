@@ -0,0 +1,127 @@
+package consul
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryKV(t *testing.T) {
+	kv := NewMemoryKV()
+	kv.Load(map[string][]byte{"service/name": []byte("seed")})
+	c, err := NewClient(SetKV(kv), RefreshPeriod(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	type testStruct struct {
+		Name String
+		Port int `consul:"default:80"`
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Name.String() != "seed" || config.Port != 80 {
+		t.Errorf("got %q, %d", config.Name.String(), config.Port)
+	}
+	if err := kv.Put("service/name", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		return config.Name.String() == "changed"
+	})
+	if ok, _ := kv.CAS("service/port", []byte("81"), 0); ok {
+		t.Error("CAS with stale index is applied")
+	}
+	if ok, _ := kv.CAS("service/new", []byte("1"), 0); !ok {
+		t.Error("CAS of absent key is not applied")
+	}
+	if err := kv.DeleteTree("service/"); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := kv.Keys(""); len(keys) != 0 {
+		t.Errorf("got %v", keys)
+	}
+}
+
+func TestMemoryKV_Concurrent(t *testing.T) {
+	kv := NewMemoryKV()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("key/%d", i)
+			_ = kv.Put(path, []byte(path))
+			_, _ = kv.Get(path)
+			_, _ = kv.Keys("key/")
+		}(i)
+	}
+	wg.Wait()
+	keys, _ := kv.Keys("key/")
+	if len(keys) != 10 {
+		t.Errorf("got %v", keys)
+	}
+	value, _ := kv.Get("key/3")
+	if !reflect.DeepEqual(value, []byte("key/3")) {
+		t.Errorf("got %q", value)
+	}
+}
+
+func TestMemoryKV_GetMeta(t *testing.T) {
+	kv := NewMemoryKV()
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = kv.Put("a", []byte("1"))
+	_ = kv.Put("b", []byte("1"))
+	_ = kv.Put("a", []byte("2"))
+	meta, err := c.GetMeta("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.CreateIndex != 1 || meta.ModifyIndex != 3 {
+		t.Errorf("got %+v", meta)
+	}
+	if ok, _ := c.CASPut("a", []byte("3"), meta.ModifyIndex); !ok {
+		t.Error("CAS with current index is not applied")
+	}
+	if _, err := newTestClient(t, testKV{}).GetMeta("a"); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestClient_PullOrPushWithIndex(t *testing.T) {
+	type testStruct struct {
+		Name string
+		Port int `consul:"default:80"`
+	}
+	kv := NewMemoryKV()
+	_ = kv.Put("other", []byte("x"))
+	_ = kv.Put("service/name", []byte("api"))
+	c := newTestClient(t, kv)
+	indices, err := c.PullOrPushWithIndex("service", &testStruct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := kv.GetMeta("service/name")
+	expected := map[string]uint64{"service/name": meta.ModifyIndex}
+	if !reflect.DeepEqual(indices, expected) || meta.ModifyIndex == 0 {
+		t.Errorf("got %v", indices)
+	}
+	if _, err := newTestClient(t, testKV{}).PullOrPushWithIndex("service", &testStruct{}); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func newTestClient(t *testing.T, kv KV) *Client {
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
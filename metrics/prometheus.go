@@ -0,0 +1,81 @@
+//go:build prometheus
+
+// Package metrics reports Prometheus metrics of consul client.
+// It is built with prometheus build tag, so the dependency is optional.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/devimteam/consul.v3"
+)
+
+// WithPrometheusMetrics returns option which registers client metrics on registry,
+// or on prometheus.DefaultRegisterer if registry is nil:
+//
+//	consul_kv_get_total{status}              - reads from KV
+//	consul_kv_put_total{status}              - writes to KV
+//	consul_kv_get_duration_seconds           - duration of reads from KV
+//	consul_watch_update_total{path,status}   - updates of watched values
+//
+// Status is either success or error. Blocking queries of watches are not counted as reads.
+// The option may be built many times, e.g. for several clients: metrics which are already
+// registered on registry are reused. It panics if registry has other collectors with the same names.
+func WithPrometheusMetrics(registry prometheus.Registerer) consul.Option {
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	gets := register(registry, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_kv_get_total",
+		Help: "Total number of reads from Consul KV.",
+	}, []string{"status"})).(*prometheus.CounterVec)
+	puts := register(registry, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_kv_put_total",
+		Help: "Total number of writes to Consul KV.",
+	}, []string{"status"})).(*prometheus.CounterVec)
+	getDuration := register(registry, prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "consul_kv_get_duration_seconds",
+		Help:    "Duration of reads from Consul KV.",
+		Buckets: prometheus.DefBuckets,
+	})).(prometheus.Histogram)
+	updates := register(registry, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_watch_update_total",
+		Help: "Total number of watched values updates.",
+	}, []string{"path", "status"})).(*prometheus.CounterVec)
+
+	onGet := func(duration time.Duration, err error) {
+		gets.WithLabelValues(status(err)).Inc()
+		getDuration.Observe(duration.Seconds())
+	}
+	onPut := func(_ time.Duration, err error) {
+		puts.WithLabelValues(status(err)).Inc()
+	}
+	return consul.WithOptions(
+		consul.WithKVMiddleware(func(kv consul.KV) consul.KV {
+			return consul.NewMetricsKV(kv, onGet, onPut)
+		}),
+		consul.WithWatchHook(func(path string, err error) {
+			updates.WithLabelValues(path, status(err)).Inc()
+		}),
+	)
+}
+
+// register registers c on registry and returns it,
+// or returns the collector which is already registered instead of it.
+func register(registry prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := registry.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
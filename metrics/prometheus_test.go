@@ -0,0 +1,52 @@
+//go:build prometheus
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/devimteam/consul.v3"
+)
+
+func TestWithPrometheusMetrics(t *testing.T) {
+	type testStruct struct {
+		Name string `consul:"default:api"`
+	}
+	registry := prometheus.NewRegistry()
+	// Options for several clients share metrics.
+	_ = WithPrometheusMetrics(registry)
+	c, err := consul.NewClient(consul.SetKV(consul.NewMemoryKV()), consul.DisableWatch, WithPrometheusMetrics(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	if err := c.PullOrPush("service", &testStruct{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Transaction([]consul.TxnOp{consul.SetOp("service/name", "web")}); err != nil {
+		t.Fatalf("transaction is not supported with metrics: %v", err)
+	}
+	if n := counter(t, registry, "consul_kv_get_total"); n != 2 {
+		t.Errorf("got %v gets", n)
+	}
+}
+
+// counter returns sum of counter name on registry.
+func counter(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			sum += metric.GetCounter().GetValue()
+		}
+	}
+	return sum
+}
@@ -0,0 +1,102 @@
+package consul
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type migration struct {
+	oldPath, newPath string
+}
+
+// MigrateKey copies value of oldPath to newPath, e.g. after a field is renamed,
+// and deletes oldPath if deleteSource is true.
+// It does nothing if oldPath does not exist, and it does not overwrite newPath if it already exists,
+// so it may be run at every start of a service.
+func (c *Client) MigrateKey(oldPath, newPath string, deleteSource bool) error {
+	exists, err := c.keyExists(oldPath)
+	if err != nil || !exists {
+		return err
+	}
+	return c.migrateKey(oldPath, newPath, deleteSource)
+}
+
+// MigrateTree is like MigrateKey, but for all keys under oldPrefix,
+// which are copied with the same relative paths under newPrefix.
+func (c *Client) MigrateTree(oldPrefix, newPrefix string, deleteSource bool) error {
+	oldPrefix = strings.TrimSuffix(oldPrefix, "/") + "/"
+	newPrefix = strings.TrimSuffix(newPrefix, "/") + "/"
+	if oldPrefix == newPrefix {
+		return nil
+	}
+	keys, err := c.kv.Keys(oldPrefix)
+	if err != nil {
+		return errors.Wrapf(err, "keys from '%s'", oldPrefix)
+	}
+	for _, key := range keys {
+		if err := c.migrateKey(key, newPrefix+strings.TrimPrefix(key, oldPrefix), deleteSource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddMigration registers rename of key or prefix oldPath to newPath, which is applied by RunMigrations.
+func (c *Client) AddMigration(oldPath, newPath string) {
+	c.migrations.lock.Lock()
+	defer c.migrations.lock.Unlock()
+	c.migrations.list = append(c.migrations.list, migration{oldPath: oldPath, newPath: newPath})
+}
+
+// RunMigrations applies migrations registered with AddMigration in the order they were added.
+// Both the key and the keys under the prefix are moved, so old keys are deleted:
+// services reading them should be updated before.
+// It should be called before values are loaded, usually at start of a service.
+func (c *Client) RunMigrations() error {
+	c.migrations.lock.Lock()
+	list := append([]migration(nil), c.migrations.list...)
+	c.migrations.lock.Unlock()
+	for _, m := range list {
+		if err := c.MigrateKey(m.oldPath, m.newPath, true); err != nil {
+			return errors.Wrapf(err, "migrate '%s' to '%s'", m.oldPath, m.newPath)
+		}
+		if err := c.MigrateTree(m.oldPath, m.newPath, true); err != nil {
+			return errors.Wrapf(err, "migrate '%s' to '%s'", m.oldPath, m.newPath)
+		}
+	}
+	return nil
+}
+
+func (c *Client) keyExists(path string) (bool, error) {
+	keys, err := c.kv.Keys(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "keys from '%s'", path)
+	}
+	for _, key := range keys {
+		if key == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) migrateKey(oldPath, newPath string, deleteSource bool) error {
+	if oldPath == newPath {
+		return nil
+	}
+	value, err := c.kv.Get(oldPath)
+	if err != nil {
+		return errors.Wrapf(err, "get from '%s'", oldPath)
+	}
+	// Value is written only if newPath is absent, so values written after a previous run are kept.
+	if _, err := c.kv.CAS(newPath, value, 0); err != nil {
+		return errors.Wrapf(err, "cas to '%s'", newPath)
+	}
+	if deleteSource {
+		if err := c.kv.Delete(oldPath); err != nil {
+			return errors.Wrapf(err, "delete '%s'", oldPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package consul
+
+import (
+	"testing"
+)
+
+func TestClient_MigrateKey(t *testing.T) {
+	kv := testKV{"service/timeout": []byte("5s"), "service/timeouts": []byte("other")}
+	c := newTestClient(t, kv)
+	if err := c.MigrateKey("service/timeout", "service/request.timeout", false); err != nil {
+		t.Fatal(err)
+	}
+	if string(kv["service/request.timeout"]) != "5s" || string(kv["service/timeout"]) != "5s" {
+		t.Errorf("got %v", kv)
+	}
+	kv["service/request.timeout"] = []byte("10s")
+	if err := c.MigrateKey("service/timeout", "service/request.timeout", true); err != nil {
+		t.Fatal(err)
+	}
+	if string(kv["service/request.timeout"]) != "10s" {
+		t.Errorf("existing key is overwritten: got %q", kv["service/request.timeout"])
+	}
+	if _, ok := kv["service/timeout"]; ok {
+		t.Error("source key is not deleted")
+	}
+	if err := c.MigrateKey("service/timeout", "service/request.timeout", true); err != nil {
+		t.Fatal(err)
+	}
+	if len(kv) != 2 || string(kv["service/timeouts"]) != "other" {
+		t.Errorf("got %v", kv)
+	}
+}
+
+func TestClient_MigrateTree(t *testing.T) {
+	kv := testKV{"service/db/host": []byte("localhost"), "service/db/pool/size": []byte("10"), "service/dbname": []byte("app")}
+	c := newTestClient(t, kv)
+	if err := c.MigrateTree("service/db", "service/database/", true); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"service/database/host": "localhost", "service/database/pool/size": "10", "service/dbname": "app"}
+	if len(kv) != len(expected) {
+		t.Errorf("got %v", kv)
+	}
+	for key, value := range expected {
+		if string(kv[key]) != value {
+			t.Errorf("%s: got %q", key, kv[key])
+		}
+	}
+	if err := c.MigrateTree("service/db", "service/database", true); err != nil {
+		t.Fatal(err)
+	}
+	if len(kv) != len(expected) {
+		t.Errorf("got %v", kv)
+	}
+}
+
+func TestClient_RunMigrations(t *testing.T) {
+	kv := testKV{"service/port": []byte("80"), "service/limits/max": []byte("5")}
+	c := newTestClient(t, kv)
+	c.AddMigration("service/port", "service/http.port")
+	c.AddMigration("service/limits", "service/rate.limits")
+	for i := 0; i < 2; i++ {
+		if err := c.RunMigrations(); err != nil {
+			t.Fatal(err)
+		}
+		if len(kv) != 2 || string(kv["service/http.port"]) != "80" || string(kv["service/rate.limits/max"]) != "5" {
+			t.Errorf("run %d: got %v", i, kv)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package consul
 
 import (
+	"context"
+	"strings"
 	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
 )
 
 type Logger interface {
@@ -24,20 +28,206 @@ func RefreshPeriod(period time.Duration) Option {
 	}
 }
 
+// SetGroupName sets group folder returned by GroupName.
+// GROUP_NAME environment variable overrides it.
+func SetGroupName(name string) Option {
+	return func(opts *options) {
+		opts.groupName = name
+	}
+}
+
+// WithWatchJitter adds random duration in [0, maxJitter) to every refresh period of watched values,
+// so many instances started at the same time do not poll Consul at the same time.
+func WithWatchJitter(maxJitter time.Duration) Option {
+	return func(opts *options) {
+		opts.watchJitter = maxJitter
+	}
+}
+
+// WaitTime sets the maximum duration of Consul blocking queries used to watch values.
+// Zero means Consul default, which is 5 minutes.
+func WaitTime(wait time.Duration) Option {
+	return func(opts *options) {
+		opts.waitTime = wait
+	}
+}
+
 func SetKV(kv KV) Option {
 	return func(opts *options) {
 		opts.kv = kv
 	}
 }
 
+// WithRetry makes the client retry failed idempotent calls to Consul up to maxAttempts
+// attempts in total. Only network errors and 5xx responses are retried.
+// Delay before the first retry is backoff, it is doubled for every next retry, with ±10% jitter.
+// It is ignored when KV is set with SetKV, use NewRetryKV for it.
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(opts *options) {
+		opts.maxRetries = maxAttempts - 1
+		opts.retryBackoff = backoff
+	}
+}
+
+// WithSessionID makes Put associate written keys with Consul session sid,
+// so they are deleted when the session is invalidated, e.g. when the service dies.
+// Put returns ErrLockHeld for keys held by another session.
+// CAS writes keys as usual, without the session, as Consul check-and-set can not acquire keys.
+// It is ignored when KV is set with SetKV.
+func WithSessionID(sid string) Option {
+	return func(opts *options) {
+		opts.sessionID = sid
+	}
+}
+
+// WithConsulConfig sets config for Consul client.
+// It is ignored when KV is set with SetKV.
+func WithConsulConfig(cfg *consulapi.Config) Option {
+	return func(opts *options) {
+		opts.consulConfig = cfg
+	}
+}
+
+// WithDatacenter sets Consul datacenter for all KV calls.
+// Empty datacenter means the datacenter of the agent.
+// It is ignored when KV is set with SetKV.
+func WithDatacenter(dc string) Option {
+	return func(opts *options) {
+		opts.datacenter = dc
+	}
+}
+
+// WithNamespace sets Consul namespace for all KV calls.
+// Namespaces are supported by Consul Enterprise only, empty namespace means the default one.
+// It is ignored when KV is set with SetKV.
+func WithNamespace(ns string) Option {
+	return func(opts *options) {
+		opts.namespace = ns
+	}
+}
+
+// WithACLToken sets Consul ACL token for all KV calls.
+// It overrides token from config set with WithConsulConfig or from environment.
+// It is ignored when KV is set with SetKV.
+func WithACLToken(token string) Option {
+	return func(opts *options) {
+		opts.token = token
+	}
+}
+
+// WithTLS makes the client connect to Consul over HTTPS.
+// caFile is used to verify Consul certificate, system roots are used when it is empty.
+// certFile and keyFile are client certificate and key for mutual TLS, they may be empty
+// for one-way TLS. Files are loaded by NewClient, which returns error if they are invalid.
+// It is ignored when KV is set with SetKV.
+func WithTLS(certFile, keyFile, caFile string) Option {
+	return func(opts *options) {
+		opts.tls = &consulapi.TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}
+	}
+}
+
+// InsecureSkipVerify disables verification of Consul certificate.
+// It should be used only in development environments.
+func InsecureSkipVerify(opts *options) {
+	opts.insecureSkipVerify = true
+}
+
 func Normalizer(f func(string) string) Option {
 	return func(opts *options) {
 		opts.normalizer = f
 	}
 }
 
+// WithPathNormalizer sets normalizer for fields under prefix, for example
+// to load a legacy layout with other naming convention.
+// The normalizer of the longest matching prefix is used,
+// the one set with Normalizer is used for other paths.
+func WithPathNormalizer(prefix string, fn func(string) string) Option {
+	return func(opts *options) {
+		if opts.pathNormalizers == nil {
+			opts.pathNormalizers = map[string]func(string) string{}
+		}
+		opts.pathNormalizers[strings.TrimSuffix(prefix, "/")] = fn
+	}
+}
+
+// WithJSONTagFallback makes field names from json tags be used
+// for fields without name in consul tag.
+func WithJSONTagFallback() Option {
+	return func(opts *options) {
+		opts.jsonNames = true
+	}
+}
+
 func SetLogger(logger Logger) Option {
 	return func(opts *options) {
 		opts.logger = logger
 	}
 }
+
+// WithLogLevel sets the minimal level of records logged with logger set by SetLogger:
+// "debug" logs every get and put with its path, duration and size of value,
+// and every update of watched values, "info" logs watch cycles, "warn" logs retries
+// and "error", which is the default, logs failures only.
+// NewClient returns error on unknown level.
+func WithLogLevel(level string) Option {
+	return func(opts *options) {
+		opts.logLevel = level
+	}
+}
+
+// WithOptions combines opts into one option, which is useful for packages extending the client.
+func WithOptions(opts ...Option) Option {
+	return func(o *options) {
+		for _, opt := range opts {
+			opt(o)
+		}
+	}
+}
+
+// WithKVMiddleware wraps KV used by the client with mw, e.g. NewMetricsKV or NewLoggingKV.
+// Middlewares are applied in the order they were added, so the last one is the outermost.
+// Middlewares made with NewHookedKV, like NewMetricsKV and NewLoggingKV, keep optional interfaces
+// of the wrapped KV available, other ones hide them: e.g. watched values are then refreshed
+// by polling instead of Consul blocking queries and Transaction returns ErrNotSupported.
+func WithKVMiddleware(mw func(KV) KV) Option {
+	return func(opts *options) {
+		opts.kvMiddlewares = append(opts.kvMiddlewares, mw)
+	}
+}
+
+// WithWatchHook adds function which is called after every update of watched value,
+// with nil error on success. It is called from watch goroutines, so it should not block.
+func WithWatchHook(fn func(path string, err error)) Option {
+	return func(opts *options) {
+		opts.watchHooks = append(opts.watchHooks, fn)
+	}
+}
+
+// WithLoadHook adds function which is called before loading of every structure, including nested ones,
+// e.g. to start a trace span. Fields of the structure are loaded with returned context,
+// which is passed to KV implementing ContextKV, and done is called with the result of loading.
+func WithLoadHook(fn func(ctx context.Context, path string) (_ context.Context, done func(error))) Option {
+	return func(opts *options) {
+		opts.loadHooks = append(opts.loadHooks, fn)
+	}
+}
+
+// WithErrorChannelSize sets buffer size of WatchErrors channel, 100 by default.
+func WithErrorChannelSize(n int) Option {
+	return func(opts *options) {
+		if n < 0 {
+			n = 0
+		}
+		opts.errorsSize = n
+	}
+}
+
+// WithErrorHandler sets function which is called with errors of watched values refresh,
+// e.g. when new value can not be parsed. Errors are logged anyway.
+// fn is called from watch goroutines, so it should not block.
+func WithErrorHandler(fn func(path string, err error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = fn
+	}
+}
@@ -0,0 +1,21 @@
+package consul
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// redacted replaces values of fields with sensitive tag option in errors and diffs.
+const redacted = "[REDACTED]"
+
+// redactError replaces err of loading sensitive value of type t from path with an error
+// which names only the path and the type, as any part of err may contain the value,
+// quoted, escaped or truncated. err is not kept as the cause for the same reason.
+// Missing keys are reported as is, failed KV calls are logged by the client.
+func redactError(err error, path string, t reflect.Type) error {
+	if err == nil || errors.Cause(err) == ErrRequiredKeyMissing {
+		return err
+	}
+	return errors.Errorf("load %s value from path '%s': %s error, the value is sensitive", t, path, redacted)
+}
@@ -0,0 +1,81 @@
+package consul
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// ListenAndReload loads out from path with PullOrPush and reloads it each time
+// any key under path is changed, calling fn after each reload.
+// The next change is not awaited until fn returns.
+// ListenAndReload blocks until ctx is done and returns ctx error.
+// Reload errors are passed to error handler and logged.
+func (c *Client) ListenAndReload(ctx context.Context, path string, out interface{}, fn func()) error {
+	if err := c.PullOrPushWithContext(ctx, path, out); err != nil {
+		return err
+	}
+	last, err := c.Snapshot(path)
+	if err != nil {
+		return err
+	}
+	var index uint64
+	for {
+		if index, err = c.waitTree(ctx, path, index); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.watchError(path, err)
+			if err := c.sleep(ctx, c.opts.refreshPeriod); err != nil {
+				return err
+			}
+			continue
+		}
+		current, err := c.Snapshot(path)
+		if err != nil {
+			c.watchError(path, err)
+			continue
+		}
+		if reflect.DeepEqual(current, last) {
+			continue
+		}
+		if err := c.PullOrPushWithContext(ctx, path, out); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.watchError(path, err)
+			continue
+		}
+		last = current
+		fn()
+	}
+}
+
+// waitTree waits for changes under prefix with blocking query if KV supports it,
+// otherwise it waits for the refresh period.
+func (c *Client) waitTree(ctx context.Context, prefix string, index uint64) (uint64, error) {
+	var kv IndexedTreeKV
+	if asKV(c.kv, &kv) {
+		newIndex, err := kv.WaitTree(ctx, prefix, index)
+		if err != nil {
+			return index, err
+		}
+		// Index may go backwards after snapshot restore, so it should be reset.
+		if newIndex < index {
+			return 0, nil
+		}
+		return newIndex, nil
+	}
+	return index, c.sleep(ctx, c.opts.refreshPeriod)
+}
+
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,58 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_ListenAndReload(t *testing.T) {
+	type testStruct struct {
+		Name string `consul:"default:first"`
+	}
+	kv := NewMemoryKV()
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := testStruct{}
+	reloaded := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- c.ListenAndReload(ctx, "service", &config, func() {
+			reloaded <- config.Name
+		})
+	}()
+	// Changes are repeated, because the first ones may happen before the initial load.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(time.Second)
+	for i := 0; ; i++ {
+		select {
+		case <-ticker.C:
+			_ = kv.Put("other", []byte("unrelated"))
+			_ = kv.Put("service/name", []byte(fmt.Sprint("second-", i)))
+			continue
+		case name := <-reloaded:
+			if !strings.HasPrefix(name, "second-") {
+				t.Errorf("got %q", name)
+			}
+		case <-timeout:
+			t.Fatal("config is not reloaded")
+		}
+		break
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ListenAndReload is not stopped")
+	}
+}
@@ -0,0 +1,53 @@
+//go:build otel
+
+// Package tracing reports OpenTelemetry spans of consul client.
+// It is built with otel build tag, so the dependency is optional.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/devimteam/consul.v3"
+)
+
+const instrumentationName = "gopkg.in/devimteam/consul.v3/tracing"
+
+// WithTracer returns option which starts spans from tp:
+// consul.PullOrPush for every loaded structure, nested structures get child spans,
+// and consul.kv.<op> for every KV call, e.g. consul.kv.get, consul.kv.put, consul.kv.txn
+// or consul.kv.get_with_index for blocking queries of watches, with consul.path
+// and consul.datacenter attributes. Optional interfaces of KV stay available to the client.
+func WithTracer(tp trace.TracerProvider) consul.Option {
+	tracer := tp.Tracer(instrumentationName)
+	return consul.WithOptions(
+		consul.WithKVMiddleware(func(kv consul.KV) consul.KV {
+			var dc string
+			if d, ok := kv.(interface{ Datacenter() string }); ok {
+				dc = d.Datacenter()
+			}
+			return consul.NewHookedKV(kv, func(ctx context.Context, op, path string, call func(context.Context) error) (err error) {
+				ctx, span := tracer.Start(ctx, "consul.kv."+op, trace.WithAttributes(
+					attribute.String("consul.path", path),
+					attribute.String("consul.datacenter", dc),
+				))
+				defer func() { end(span, err) }()
+				return call(ctx)
+			})
+		}),
+		consul.WithLoadHook(func(ctx context.Context, path string) (context.Context, func(error)) {
+			ctx, span := tracer.Start(ctx, "consul.PullOrPush", trace.WithAttributes(attribute.String("consul.path", path)))
+			return ctx, func(err error) { end(span, err) }
+		}),
+	)
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
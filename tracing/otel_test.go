@@ -0,0 +1,91 @@
+//go:build otel
+
+package tracing
+
+import (
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gopkg.in/devimteam/consul.v3"
+)
+
+func TestWithTracer(t *testing.T) {
+	type dbConfig struct {
+		Host string `consul:"default:localhost"`
+	}
+	type testStruct struct {
+		Name     string   `consul:"default:api"`
+		Database dbConfig `consul:"name:database"`
+	}
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	c, err := consul.NewClient(consul.SetKV(consul.NewMemoryKV()), consul.DisableWatch, WithTracer(tp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	var config testStruct
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	byPath := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range spans {
+		if span.Name() != "consul.PullOrPush" {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Key == "consul.path" {
+				byPath[attr.Value.AsString()] = span
+			}
+		}
+	}
+	root, nested := byPath["service"], byPath["service/database"]
+	if root == nil || nested == nil {
+		t.Fatalf("structure spans are missing: %v", byPath)
+	}
+	if nested.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("nested structure span is not a child of root span")
+	}
+	var gets, puts int
+	for _, span := range spans {
+		switch span.Name() {
+		case "consul.kv.get":
+			gets++
+			// The structure itself is read before its span is started.
+			if spanPath(span) != "service" && span.Parent().TraceID() != root.SpanContext().TraceID() {
+				t.Errorf("get span is not in trace of PullOrPush")
+			}
+		case "consul.kv.put":
+			puts++
+		}
+	}
+	if gets == 0 || puts != 2 {
+		t.Errorf("got %d gets and %d puts", gets, puts)
+	}
+
+	if err := c.Transaction([]consul.TxnOp{consul.SetOp("service/name", "web")}); err != nil {
+		t.Fatalf("transaction is not supported with tracing: %v", err)
+	}
+	if _, err := c.GetMeta("service/name"); err != nil {
+		t.Fatalf("meta is not supported with tracing: %v", err)
+	}
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+	}
+	if !names["consul.kv.txn"] || !names["consul.kv.get_meta"] {
+		t.Errorf("got spans %v", names)
+	}
+}
+
+func spanPath(span sdktrace.ReadOnlySpan) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == "consul.path" {
+			return attr.Value.AsString()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// ErrTransactionRolledBack is returned when any operation of transaction fails,
+// so none of them are applied.
+var ErrTransactionRolledBack = errors.New("transaction is rolled back")
+
+// TxnKV is a KV which can apply several operations atomically.
+type TxnKV interface {
+	KV
+	// Txn applies all ops or none of them.
+	// It returns ErrTransactionRolledBack if any check op fails.
+	Txn(ops []TxnOp) error
+}
+
+// TxnOp is an operation of transaction. Use SetOp, DeleteOp, CheckOp and CheckIndexOp to make it.
+type TxnOp struct {
+	op consulapi.KVTxnOp
+	// checkValue marks ops made with CheckOp, which compare op.Value with the value of key.
+	checkValue bool
+}
+
+// SetOp makes operation which puts value to key.
+func SetOp(key, value string) TxnOp {
+	return TxnOp{op: consulapi.KVTxnOp{Verb: consulapi.KVSet, Key: key, Value: []byte(value)}}
+}
+
+// DeleteOp makes operation which deletes key.
+func DeleteOp(key string) TxnOp {
+	return TxnOp{op: consulapi.KVTxnOp{Verb: consulapi.KVDelete, Key: key}}
+}
+
+// CheckOp makes operation which rolls back transaction if value of key is not value.
+// Absent key has empty value, like in PullOrPush.
+// Consul transactions can not compare values, so consulKV reads the value before the transaction
+// and checks that its modify index is not changed since then.
+func CheckOp(key, value string) TxnOp {
+	return TxnOp{op: consulapi.KVTxnOp{Verb: consulapi.KVCheckIndex, Key: key, Value: []byte(value)}, checkValue: true}
+}
+
+// CheckIndexOp makes operation which rolls back transaction
+// if modify index of key is not modifyIndex, like CASPut does.
+// Zero modifyIndex checks that key does not exist.
+func CheckIndexOp(key string, modifyIndex uint64) TxnOp {
+	if modifyIndex == 0 {
+		return TxnOp{op: consulapi.KVTxnOp{Verb: consulapi.KVCheckNotExists, Key: key}}
+	}
+	return TxnOp{op: consulapi.KVTxnOp{Verb: consulapi.KVCheckIndex, Key: key, Index: modifyIndex}}
+}
+
+// Transaction applies all ops atomically: either all of them or none.
+// It returns ErrNotSupported if KV does not implement TxnKV.
+func (c *Client) Transaction(ops []TxnOp) error {
+	var kv TxnKV
+	if !asKV(c.kv, &kv) {
+		return ErrNotSupported
+	}
+	return kv.Txn(ops)
+}
+
+func (kv consulKV) Txn(ops []TxnOp) error {
+	txnOps := make(consulapi.TxnOps, len(ops))
+	for i := range ops {
+		op := ops[i].op
+		if ops[i].checkValue {
+			value, meta, err := kv.GetPair(context.Background(), op.Key)
+			if err != nil {
+				return errors.Wrapf(err, "get '%s' to check", op.Key)
+			}
+			if string(value) != string(op.Value) {
+				return errors.Wrapf(ErrTransactionRolledBack, "op %d: value of '%s' is changed", i, op.Key)
+			}
+			op = CheckIndexOp(op.Key, meta.ModifyIndex).op
+		}
+		txnOps[i] = &consulapi.TxnOp{KV: &op}
+	}
+	ok, resp, _, err := kv.txn.Txn(txnOps, kv.queryOptions(context.Background()))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		messages := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			messages[i] = fmt.Sprintf("op %d: %s", e.OpIndex, e.What)
+		}
+		return errors.Wrap(ErrTransactionRolledBack, strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// Txn checks all check ops first and then applies the others in order.
+func (kv *MemoryKV) Txn(ops []TxnOp) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	for i, op := range ops {
+		pair, exists := kv.pairs[op.op.Key]
+		switch {
+		case op.checkValue:
+			if string(pair.value) != string(op.op.Value) {
+				return errors.Wrapf(ErrTransactionRolledBack, "op %d: value of '%s' is changed", i, op.op.Key)
+			}
+		case op.op.Verb == consulapi.KVCheckIndex:
+			if !exists || pair.index != op.op.Index {
+				return errors.Wrapf(ErrTransactionRolledBack, "op %d: index of '%s' is changed", i, op.op.Key)
+			}
+		case op.op.Verb == consulapi.KVCheckNotExists:
+			if exists {
+				return errors.Wrapf(ErrTransactionRolledBack, "op %d: key '%s' exists", i, op.op.Key)
+			}
+		}
+	}
+	for _, op := range ops {
+		switch op.op.Verb {
+		case consulapi.KVSet:
+			kv.set(op.op.Key, op.op.Value)
+		case consulapi.KVDelete:
+			if _, ok := kv.pairs[op.op.Key]; ok {
+				delete(kv.pairs, op.op.Key)
+				kv.notify()
+			}
+		}
+	}
+	return nil
+}
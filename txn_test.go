@@ -0,0 +1,62 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestClient_Transaction(t *testing.T) {
+	kv := NewMemoryKV()
+	kv.Load(map[string][]byte{"service/old": []byte("x"), "service/host": []byte("a")})
+	c := newTestClient(t, kv)
+	meta, err := c.GetMeta("service/host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Transaction([]TxnOp{
+		CheckIndexOp("service/host", meta.ModifyIndex),
+		SetOp("service/host", "b"),
+		SetOp("service/port", "80"),
+		DeleteOp("service/old"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"service/host": "b", "service/port": "80"}
+	if snapshot, _ := c.Snapshot("service"); !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("got %v", snapshot)
+	}
+
+	// Index of host is changed by the previous transaction, so nothing is applied.
+	err = c.Transaction([]TxnOp{
+		SetOp("service/port", "443"),
+		CheckIndexOp("service/host", meta.ModifyIndex),
+		DeleteOp("service/host"),
+	})
+	if errors.Cause(err) != ErrTransactionRolledBack {
+		t.Errorf("expected rollback, got %v", err)
+	}
+	if err := c.Transaction([]TxnOp{CheckIndexOp("service/port", 0), SetOp("service/port", "443")}); errors.Cause(err) != ErrTransactionRolledBack {
+		t.Errorf("expected rollback on existing key, got %v", err)
+	}
+	if err := c.Transaction([]TxnOp{CheckOp("service/host", "a"), SetOp("service/port", "443")}); errors.Cause(err) != ErrTransactionRolledBack {
+		t.Errorf("expected rollback on changed value, got %v", err)
+	}
+	if snapshot, _ := c.Snapshot("service"); !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("rolled back transaction is applied: %v", snapshot)
+	}
+	err = c.Transaction([]TxnOp{CheckOp("service/host", "b"), CheckOp("service/old", ""), SetOp("service/port", "443")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, _ := c.Snapshot("service"); snapshot["service/port"] != "443" {
+		t.Errorf("got %v", snapshot)
+	}
+
+	c = newTestClient(t, testKV{})
+	if err := c.Transaction([]TxnOp{SetOp("key", "value")}); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// TagError describes a mistake in consul tag of a field.
+type TagError struct {
+	Field   string
+	Tag     string
+	Message string
+}
+
+func (e TagError) Error() string {
+	return fmt.Sprintf("field %s: tag `%s`: %s", e.Field, e.Tag, e.Message)
+}
+
+// Validate checks consul tags of all fields of i, including nested structures,
+// and returns all found mistakes: unknown options, contradictory options and
+// default values which can not be parsed. It does not connect to Consul,
+// so it may be called at startup to fail fast. Options opts are applied to the client, e.g. WithJSONTagFallback.
+func Validate(i interface{}, opts ...Option) []error {
+	t := reflect.TypeOf(i)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return []error{errors.New("i is not a structure")}
+	}
+	c, err := newOfflineClient(opts...)
+	if err != nil {
+		return []error{err}
+	}
+	defer c.Stop()
+	var errs []error
+	c.validateStruct(t, "", map[reflect.Type]bool{}, &errs)
+	return errs
+}
+
+func (c *Client) validateStruct(t reflect.Type, prefix string, visited map[reflect.Type]bool, errs *[]error) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+	for i, n := 0, t.NumField(); i < n; i++ {
+		fieldType := t.Field(i)
+		if fieldType.PkgPath != "" {
+			continue
+		}
+		tag := fieldType.Tag.Get("consul")
+		opts := makeTagOpts(tag)
+		name := prefix + fieldType.Name
+		report := func(format string, args ...interface{}) {
+			*errs = append(*errs, TagError{Field: name, Tag: tag, Message: fmt.Sprintf(format, args...)})
+		}
+		for _, option := range opts.unknown {
+			report("unknown option '%s'", option)
+		}
+		for _, message := range opts.invalid {
+			report("%s", message)
+		}
+		if opts.Skip {
+			continue
+		}
+		if opts.Required && opts.Default != nil {
+			report("required and default options can not be used together")
+		}
+		if opts.Required && opts.DefaultEnv != nil {
+			report("required and default_env options can not be used together")
+		}
+		if isPlainStruct(fieldType.Type) && !opts.Flatten {
+			if opts.Default != nil || opts.DefaultEnv != nil {
+				report("default option is not supported for structures")
+			}
+			st := fieldType.Type
+			if st.Kind() == reflect.Ptr {
+				st = st.Elem()
+			}
+			c.validateStruct(st, name+".", visited, errs)
+			continue
+		}
+		if opts.Inline {
+			report("inline option is supported only for structures")
+		}
+		if opts.Default == nil || opts.Required {
+			continue
+		}
+		v := reflect.New(fieldType.Type).Elem()
+		if err := c.pullOrPush(context.Background(), modePullWithDefaults, "validate", v, &fieldType); err != nil {
+			report("invalid default value: %v", err)
+		}
+	}
+}
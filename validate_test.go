@@ -0,0 +1,50 @@
+package consul
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	type nested struct {
+		Port int `consul:"default:port"`
+	}
+	type testStruct struct {
+		Valid    int           `consul:"default:5"`
+		Typo     int           `consul:"defalt:5"`
+		Conflict string        `consul:"required:true;default:x"`
+		Int      int           `consul:"default:abc"`
+		Timeout  time.Duration `consul:"default:5 minutes"`
+		Inline   string        `consul:"inline"`
+		Period   String        `consul:"period:soon"`
+		Nested   nested
+		Skipped  chan int `consul:"skip"`
+	}
+	errs := Validate(&testStruct{})
+	expected := []TagError{
+		{Field: "Typo", Tag: "defalt:5"},
+		{Field: "Conflict", Tag: "required:true;default:x"},
+		{Field: "Int", Tag: "default:abc"},
+		{Field: "Timeout", Tag: "default:5 minutes"},
+		{Field: "Inline", Tag: "inline"},
+		{Field: "Period", Tag: "period:soon"},
+		{Field: "Nested.Port", Tag: "default:port"},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i := range expected {
+		tagErr, ok := errs[i].(TagError)
+		if !ok || tagErr.Field != expected[i].Field || tagErr.Tag != expected[i].Tag || tagErr.Message == "" {
+			t.Errorf("error %d: expected %+v, got %v", i, expected[i], errs[i])
+		}
+	}
+	type validStruct struct {
+		Name  string            `consul:"name:n;default:x"`
+		Ports []int             `consul:"sep:;"`
+		Map   map[string]string `consul:"default:a=1"`
+	}
+	if errs := Validate(validStruct{}); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
@@ -0,0 +1,89 @@
+package consul
+
+import (
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/api/watch"
+	"github.com/pkg/errors"
+)
+
+// WatchPlan watches path with Consul watch plan of key type and updates target on every change.
+// Unlike Watch, where values are refreshed by the client watch loop, every plan runs
+// its own blocking queries, so a path should not be watched both ways.
+// Plans are stopped by Stop. They use datacenter and ACL token of the client.
+// It returns ErrNotSupported if KV is set with SetKV, and an error if namespace or partition
+// is set with WithNamespace or Partition, as Consul watch plans do not support them.
+func (c *Client) WatchPlan(path string, target Updatable) error {
+	item := &watchItem{path: path, target: target}
+	return c.runPlan(map[string]interface{}{"type": "key", "key": path}, func(raw interface{}) {
+		var value []byte
+		if pair, ok := raw.(*consulapi.KVPair); ok && pair != nil {
+			value = pair.Value
+		}
+		c.watch.lock.Lock()
+		c.applyUpdate(item, value)
+		c.watch.lock.Unlock()
+	})
+}
+
+// WatchPlanPrefix is like WatchPlan, but watches keys directly under prefix with plan
+// of keyprefix type and updates out with their values by names, like WatchMap does.
+func (c *Client) WatchPlanPrefix(prefix string, out *MapValue) error {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	return c.runPlan(map[string]interface{}{"type": "keyprefix", "prefix": prefix}, func(raw interface{}) {
+		pairs, _ := raw.(consulapi.KVPairs)
+		values := make(map[string]string, len(pairs))
+		for _, pair := range pairs {
+			name := strings.TrimPrefix(pair.Key, prefix)
+			if name == "" || strings.Contains(name, "/") {
+				continue
+			}
+			values[name] = string(pair.Value)
+		}
+		out.set(values)
+		c.watchUpdated(prefix, nil)
+	})
+}
+
+// runPlan starts watch plan with params, which calls handler with every new result, until the client is stopped.
+func (c *Client) runPlan(params map[string]interface{}, handler func(raw interface{})) error {
+	if c.consul == nil {
+		return ErrNotSupported
+	}
+	// Otherwise the plan would watch a key other than the one read by the client.
+	if c.opts.namespace != "" || c.opts.partition != "" {
+		return errors.New("watch plans do not support namespaces and partitions")
+	}
+	// Datacenter and token of params are ignored by plans run with a client,
+	// they are set in the client config by NewClient instead.
+	plan, err := watch.Parse(params)
+	if err != nil {
+		return err
+	}
+	plan.Handler = func(_ uint64, raw interface{}) {
+		handler(raw)
+	}
+	c.plans.lock.Lock()
+	defer c.plans.lock.Unlock()
+	if c.ctx.Err() != nil {
+		return c.ctx.Err()
+	}
+	c.plans.list = append(c.plans.list, plan)
+	go func() {
+		if err := plan.RunWithClientAndHclog(c.consul, nil); err != nil {
+			c.watchError(plan.Type, err)
+		}
+	}()
+	return nil
+}
+
+// stopPlans stops all watch plans.
+func (c *Client) stopPlans() {
+	c.plans.lock.Lock()
+	defer c.plans.lock.Unlock()
+	for _, plan := range c.plans.list {
+		plan.Stop()
+	}
+	c.plans.list = nil
+}
@@ -0,0 +1,68 @@
+package consul
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClient_WatchPlan(t *testing.T) {
+	s := newConsulServer(t)
+	s.set("service/name", "first")
+	s.set("service/labels/env", "dev")
+	c := s.client(t)
+	defer c.Stop()
+	var name String
+	var labels MapValue
+	if err := c.WatchPlan("service/name", &name); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WatchPlanPrefix("service/labels", &labels); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return name.String() == "first" && labels.Map()["env"] == "dev" })
+	s.set("service/name", "second")
+	s.set("service/labels/team", "core")
+	waitFor(t, func() bool { return name.String() == "second" && labels.Map()["team"] == "core" })
+
+	if err := newTestClient(t, testKV{}).WatchPlan("service/name", &name); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClient_WatchPlan_Options(t *testing.T) {
+	s := newConsulServer(t)
+	s.set("service/name", "first")
+	c := s.client(t, WithDatacenter("dc2"), WithACLToken("secret"))
+	defer c.Stop()
+	var name String
+	if err := c.WatchPlan("service/name", &name); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return name.String() == "first" })
+	queries := s.recorded()
+	if last := queries[len(queries)-1]; last["dc"] != "dc2" || last["token"] != "secret" {
+		t.Errorf("got datacenter %q and token %q", last["dc"], last["token"])
+	}
+
+	partition := c.Partition("team")
+	defer partition.Stop()
+	if err := partition.WatchPlan("service/name", &name); err == nil {
+		t.Error("expected error for partition")
+	}
+	namespaced := s.client(t, WithNamespace("team"))
+	defer namespaced.Stop()
+	if err := namespaced.WatchPlanPrefix("service", &MapValue{}); err == nil {
+		t.Error("expected error for namespace")
+	}
+}
@@ -1,84 +1,224 @@
 package consul
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync/atomic"
-	"time"
 
 	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
 )
 
 func init() {
 	RegisterWellKnownType(reflect.TypeOf(String{}), watchableString)
 	RegisterWellKnownType(reflect.TypeOf(Duration{}), watchableDuration)
 	RegisterWellKnownType(reflect.TypeOf(Int{}), watchableInt)
+	RegisterWellKnownType(reflect.TypeOf(Uint32{}), watchableUint32)
+	RegisterWellKnownType(reflect.TypeOf(Uint64{}), watchableUint64)
+	RegisterWellKnownType(reflect.TypeOf(Float64{}), watchableFloat64)
+	RegisterWellKnownType(reflect.TypeOf(Bool{}), watchableBool)
+	RegisterWellKnownType(reflect.TypeOf(Bytes{}), watchableBytes)
+	RegisterWellKnownType(reflect.TypeOf(CSV{}), watchableCSV)
 	RegisterWellKnownType(reflect.TypeOf(Toml{}), tomlConfig)
+	RegisterWellKnownType(reflect.TypeOf(JSON{}), jsonConfig)
+	RegisterWellKnownType(reflect.TypeOf(YAML{}), yamlConfig)
+
+	stringifiers[reflect.TypeOf(String{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		s := v.Interface().(String)
+		return s.String(), nil
+	}
+	stringifiers[reflect.TypeOf(Duration{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		d := v.Interface().(Duration)
+		return d.Duration().String(), nil
+	}
+	stringifiers[reflect.TypeOf(Int{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		i := v.Interface().(Int)
+		return strconv.Itoa(i.Int()), nil
+	}
+	stringifiers[reflect.TypeOf(Uint32{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		return strconv.FormatUint(uint64(v.Interface().(Uint32).Uint32()), 10), nil
+	}
+	stringifiers[reflect.TypeOf(Uint64{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		return strconv.FormatUint(v.Interface().(Uint64).Uint64(), 10), nil
+	}
+	stringifiers[reflect.TypeOf(Float64{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		return strconv.FormatFloat(v.Interface().(Float64).Float64(), 'g', -1, 64), nil
+	}
+	stringifiers[reflect.TypeOf(Bool{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		return strconv.FormatBool(v.Interface().(Bool).Bool()), nil
+	}
+	stringifiers[reflect.TypeOf(Bytes{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		return base64.StdEncoding.EncodeToString(v.Interface().(Bytes).Bytes()), nil
+	}
+	stringifiers[reflect.TypeOf(CSV{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		c := v.Interface().(CSV)
+		return strings.Join(c.Strings(), ","), nil
+	}
+	stringifiers[reflect.TypeOf(Toml{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		tree := v.Interface().(Toml).Tree()
+		if tree == nil {
+			return "", nil
+		}
+		return tree.ToTomlString()
+	}
+	stringifiers[reflect.TypeOf(JSON{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		raw, err := json.Marshal(v.Interface().(JSON).Get())
+		return string(raw), err
+	}
+	stringifiers[reflect.TypeOf(YAML{})] = func(v reflect.Value, _ tagOpts) (string, error) {
+		y := v.Interface().(YAML)
+		value, _ := y.v.Load().(yamlValue)
+		return string(value.raw), nil
+	}
 }
 
-type String struct {
+type Uint32 struct {
 	v atomic.Value
 }
 
-func (s *String) Update(raw []byte) error {
-	s.v.Store(string(raw))
+func (d *Uint32) Update(raw []byte) error {
+	i, err := strconv.ParseUint(string(raw), 10, 32)
+	if err != nil {
+		return err
+	}
+	d.v.Store(uint32(i))
 	return nil
 }
 
-func (s *String) String() string {
-	str, _ := s.v.Load().(string)
-	return str
+func (d Uint32) Uint32() uint32 {
+	i, _ := d.v.Load().(uint32)
+	return i
 }
 
-func watchableString(_ string, raw []byte) (interface{}, error) {
-	s := String{}
-	return s, s.Update(raw)
+func watchableUint32(_ string, raw []byte) (interface{}, error) {
+	d := Uint32{}
+	return d, d.Update(raw)
 }
 
-type Duration struct {
+type Uint64 struct {
 	v atomic.Value
 }
 
-func (d *Duration) Update(raw []byte) error {
-	dur, err := time.ParseDuration(string(raw))
+func (d *Uint64) Update(raw []byte) error {
+	i, err := strconv.ParseUint(string(raw), 10, 64)
 	if err != nil {
 		return err
 	}
-	d.v.Store(dur)
+	d.v.Store(i)
 	return nil
 }
 
-func (d Duration) Duration() time.Duration {
-	dur, _ := d.v.Load().(time.Duration)
-	return dur
+func (d Uint64) Uint64() uint64 {
+	i, _ := d.v.Load().(uint64)
+	return i
 }
 
-func watchableDuration(_ string, raw []byte) (interface{}, error) {
-	d := Duration{}
+func watchableUint64(_ string, raw []byte) (interface{}, error) {
+	d := Uint64{}
 	return d, d.Update(raw)
 }
 
-type Int struct {
+type Float64 struct {
 	v atomic.Value
 }
 
-func (d *Int) Update(raw []byte) error {
-	i, err := strconv.Atoi(string(raw))
+func (f *Float64) Update(raw []byte) error {
+	n, err := strconv.ParseFloat(string(raw), 64)
 	if err != nil {
 		return err
 	}
-	d.v.Store(i)
+	f.v.Store(n)
 	return nil
 }
 
-func (d Int) Int() int {
-	i, _ := d.v.Load().(int)
-	return i
+func (f Float64) Float64() float64 {
+	n, _ := f.v.Load().(float64)
+	return n
 }
 
-func watchableInt(_ string, raw []byte) (interface{}, error) {
-	d := Int{}
-	return d, d.Update(raw)
+func watchableFloat64(_ string, raw []byte) (interface{}, error) {
+	f := Float64{}
+	return f, f.Update(raw)
+}
+
+type Bool struct {
+	v atomic.Value
+}
+
+func (b *Bool) Update(raw []byte) error {
+	v, err := strconv.ParseBool(string(raw))
+	if err != nil {
+		return err
+	}
+	b.v.Store(v)
+	return nil
+}
+
+func (b Bool) Bool() bool {
+	v, _ := b.v.Load().(bool)
+	return v
+}
+
+func watchableBool(_ string, raw []byte) (interface{}, error) {
+	b := Bool{}
+	return b, b.Update(raw)
+}
+
+// Bytes holds binary value which is stored base64 encoded.
+type Bytes struct {
+	v atomic.Value
+}
+
+func (b *Bytes) Update(raw []byte) error {
+	decoded, err := base64.StdEncoding.DecodeString(string(raw))
+	if err != nil {
+		return err
+	}
+	b.v.Store(decoded)
+	return nil
+}
+
+// Bytes returns a copy of the value.
+func (b Bytes) Bytes() []byte {
+	v, _ := b.v.Load().([]byte)
+	return append([]byte(nil), v...)
+}
+
+func watchableBytes(_ string, raw []byte) (interface{}, error) {
+	b := Bytes{}
+	return b, b.Update(raw)
+}
+
+// CSV holds a list of comma separated strings.
+// Whitespace around elements is trimmed, an empty value is an empty list.
+type CSV struct {
+	v atomic.Value
+}
+
+func (c *CSV) Update(raw []byte) error {
+	list := []string{}
+	if s := strings.TrimSpace(string(raw)); s != "" {
+		list = strings.Split(s, ",")
+		for i := range list {
+			list[i] = strings.TrimSpace(list[i])
+		}
+	}
+	c.v.Store(list)
+	return nil
+}
+
+// Strings returns a copy of the list.
+func (c *CSV) Strings() []string {
+	list, _ := c.v.Load().([]string)
+	return append([]string{}, list...)
+}
+
+func watchableCSV(_ string, raw []byte) (interface{}, error) {
+	c := CSV{}
+	return c, c.Update(raw)
 }
 
 type Toml struct {
@@ -110,3 +250,111 @@ func (t Toml) Tree() *toml.Tree {
 	tree, _ := t.v.Load().(*toml.Tree)
 	return tree
 }
+
+// JSON holds a value decoded from JSON.
+// Zero JSON decodes into interface{}, use NewJSON to decode into a typed value.
+type JSON struct {
+	typ reflect.Type
+	v   atomic.Value
+}
+
+type jsonValue struct {
+	v interface{}
+}
+
+// NewJSON returns JSON which decodes values into the type of proto.
+// Pointer protos are dereferenced, so Get returns values, not pointers.
+func NewJSON(proto interface{}) *JSON {
+	t := reflect.TypeOf(proto)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return &JSON{typ: t}
+}
+
+func jsonConfig(_ string, raw []byte) (interface{}, error) {
+	j := JSON{}
+	if err := j.Update(raw); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *JSON) Update(raw []byte) error {
+	t := j.typ
+	if t == nil {
+		t = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	v := reflect.New(t)
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return err
+		}
+	}
+	j.v.Store(jsonValue{v: v.Elem().Interface()})
+	return nil
+}
+
+func (j JSON) Get() interface{} {
+	v, _ := j.v.Load().(jsonValue)
+	return v.v
+}
+
+// YAML holds a value decoded from YAML and its raw form.
+type YAML struct {
+	v atomic.Value
+}
+
+// yamlValue keeps raw and decoded forms together, so they are always consistent.
+type yamlValue struct {
+	raw []byte
+	v   interface{}
+}
+
+func yamlConfig(_ string, raw []byte) (interface{}, error) {
+	y := YAML{}
+	if err := y.Update(raw); err != nil {
+		return nil, err
+	}
+	return y, nil
+}
+
+func (y *YAML) Update(raw []byte) error {
+	var v interface{}
+	if err := yaml.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	y.v.Store(yamlValue{raw: append([]byte(nil), raw...), v: v})
+	return nil
+}
+
+// Get returns the decoded value, which is nil for empty content.
+func (y *YAML) Get() interface{} {
+	v, _ := y.v.Load().(yamlValue)
+	return v.v
+}
+
+// GetInto decodes the current value into target, which should be a pointer.
+func (y *YAML) GetInto(target interface{}) error {
+	v, _ := y.v.Load().(yamlValue)
+	return yaml.Unmarshal(v.raw, target)
+}
+
+// MapValue holds values of keys under a prefix by their names, see Client.WatchMap.
+type MapValue struct {
+	v atomic.Value
+}
+
+func (m *MapValue) set(values map[string]string) {
+	m.v.Store(values)
+}
+
+// Map returns a copy of the values.
+func (m *MapValue) Map() map[string]string {
+	values, _ := m.v.Load().(map[string]string)
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,77 @@
+//go:build !go1.18
+// +build !go1.18
+
+package consul
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// String, Duration and Int are defined with WatchedValue since Go 1.18.
+
+type String struct {
+	v atomic.Value
+}
+
+func (s *String) Update(raw []byte) error {
+	s.v.Store(string(raw))
+	return nil
+}
+
+func (s *String) String() string {
+	str, _ := s.v.Load().(string)
+	return str
+}
+
+func watchableString(_ string, raw []byte) (interface{}, error) {
+	s := String{}
+	return s, s.Update(raw)
+}
+
+type Duration struct {
+	v atomic.Value
+}
+
+func (d *Duration) Update(raw []byte) error {
+	dur, err := timeDuration("", raw)
+	if err != nil {
+		return err
+	}
+	d.v.Store(dur)
+	return nil
+}
+
+func (d *Duration) Duration() time.Duration {
+	dur, _ := d.v.Load().(time.Duration)
+	return dur
+}
+
+func watchableDuration(_ string, raw []byte) (interface{}, error) {
+	d := Duration{}
+	return d, d.Update(raw)
+}
+
+type Int struct {
+	v atomic.Value
+}
+
+func (d *Int) Update(raw []byte) error {
+	i, err := strconv.Atoi(string(raw))
+	if err != nil {
+		return err
+	}
+	d.v.Store(i)
+	return nil
+}
+
+func (d *Int) Int() int {
+	i, _ := d.v.Load().(int)
+	return i
+}
+
+func watchableInt(_ string, raw []byte) (interface{}, error) {
+	d := Int{}
+	return d, d.Update(raw)
+}
@@ -0,0 +1,268 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestFloat64(t *testing.T) {
+	f := Float64{}
+	if f.Float64() != 0 {
+		t.Errorf("zero value: got %v", f.Float64())
+	}
+	if err := f.Update([]byte("1.25")); err != nil {
+		t.Fatal(err)
+	}
+	if f.Float64() != 1.25 {
+		t.Errorf("got %v", f.Float64())
+	}
+	if err := f.Update([]byte("abc")); err == nil {
+		t.Error("expected error on invalid input")
+	}
+	if f.Float64() != 1.25 {
+		t.Errorf("value is changed after invalid update: %v", f.Float64())
+	}
+}
+
+func TestBool(t *testing.T) {
+	type testStruct struct {
+		Enabled Bool `consul:"default:true"`
+	}
+	kv := testKV{}
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("flags", &config); err != nil {
+		t.Fatal(err)
+	}
+	if !config.Enabled.Bool() {
+		t.Error("expected true")
+	}
+	if string(kv["flags/enabled"]) != "true" {
+		t.Errorf("default is not pushed: %q", kv["flags/enabled"])
+	}
+	if err := config.Enabled.Update([]byte("false")); err != nil {
+		t.Fatal(err)
+	}
+	if config.Enabled.Bool() {
+		t.Error("expected false")
+	}
+	if err := config.Enabled.Update([]byte("maybe")); err == nil {
+		t.Error("expected error on invalid input")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type limits struct {
+		RPS   int `json:"rps"`
+		Burst int `json:"burst"`
+	}
+	type settings struct {
+		Name   string `json:"name"`
+		Limits limits `json:"limits"`
+	}
+	type testStruct struct {
+		Settings *JSON `consul:"default:{\"name\":\"svc\",\"limits\":{\"rps\":10}}"`
+		Raw      JSON  `consul:"default:[1,2]"`
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{Settings: NewJSON(settings{})}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := config.Settings.Get().(settings)
+	if !ok {
+		t.Fatalf("unexpected type %T", config.Settings.Get())
+	}
+	if got.Name != "svc" || got.Limits.RPS != 10 || got.Limits.Burst != 0 {
+		t.Errorf("got %+v", got)
+	}
+	if raw, ok := config.Raw.Get().([]interface{}); !ok || len(raw) != 2 {
+		t.Errorf("Raw: got %#v", config.Raw.Get())
+	}
+	if err := config.Settings.Update([]byte(`{"name":`)); err == nil {
+		t.Error("expected error on malformed json")
+	}
+	if got := config.Settings.Get().(settings); got.Name != "svc" {
+		t.Errorf("value is changed after malformed update: %+v", got)
+	}
+}
+
+func TestUint64(t *testing.T) {
+	type testStruct struct {
+		Counter Uint64 `consul:"default:0"`
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("stats", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Counter.Uint64() != 0 {
+		t.Errorf("got %d", config.Counter.Uint64())
+	}
+	if err := config.Counter.Update([]byte("18446744073709551615")); err != nil {
+		t.Fatal(err)
+	}
+	if config.Counter.Uint64() != math.MaxUint64 {
+		t.Errorf("got %d", config.Counter.Uint64())
+	}
+	if err := config.Counter.Update([]byte("-1")); err == nil {
+		t.Error("expected error on negative input")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	key := []byte{0, 1, 2, 254, 255}
+	b := Bytes{}
+	if err := b.Update([]byte(base64.StdEncoding.EncodeToString(key))); err != nil {
+		t.Fatal(err)
+	}
+	got := b.Bytes()
+	if !bytes.Equal(got, key) {
+		t.Errorf("got %v", got)
+	}
+	got[0] = 42
+	if b.Bytes()[0] != 0 {
+		t.Error("value is mutated through returned slice")
+	}
+	if err := b.Update([]byte("not base64!")); err == nil {
+		t.Error("expected error on invalid base64")
+	}
+}
+
+func TestUint32(t *testing.T) {
+	type testStruct struct {
+		Port Uint32 `consul:"default:8080"`
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Port.Uint32() != 8080 {
+		t.Errorf("got %d", config.Port.Uint32())
+	}
+	if err := config.Port.Update([]byte("4294967296")); err == nil {
+		t.Error("expected overflow error")
+	}
+	if config.Port.Uint32() != 8080 {
+		t.Errorf("value is changed after invalid update: %d", config.Port.Uint32())
+	}
+}
+
+func TestCSV(t *testing.T) {
+	type testStruct struct {
+		Hosts CSV `consul:"default:a,b,c"`
+	}
+	c, err := NewClient(SetKV(testKV{}), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Hosts.Strings(); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("default: got %q", got)
+	}
+	for raw, expected := range map[string][]string{
+		"":            {},
+		"single":      {"single"},
+		" a , b ,c  ": {"a", "b", "c"},
+	} {
+		if err := config.Hosts.Update([]byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+		if got := config.Hosts.Strings(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: got %q", raw, got)
+		}
+	}
+	_ = config.Hosts.Update([]byte("x,y"))
+	got := config.Hosts.Strings()
+	got[0] = "z"
+	if config.Hosts.Strings()[0] != "x" {
+		t.Error("value is mutated through returned slice")
+	}
+}
+
+func TestCSV_Concurrent(t *testing.T) {
+	list := CSV{}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = list.Update([]byte(fmt.Sprint(i, ",", j)))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := list.Strings(); len(got) != 0 && len(got) != 2 {
+					t.Errorf("got %q", got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestYAML(t *testing.T) {
+	type testStruct struct {
+		Config YAML
+	}
+	kv := testKV{"service/config": []byte("server:\n  host: localhost\n  ports: [80, 443]\n")}
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"server": map[string]interface{}{"host": "localhost", "ports": []interface{}{80, 443}},
+	}
+	if got := config.Config.Get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v", got)
+	}
+	var server struct {
+		Server struct {
+			Host  string
+			Ports []int
+		}
+	}
+	if err := config.Config.GetInto(&server); err != nil {
+		t.Fatal(err)
+	}
+	if server.Server.Host != "localhost" || !reflect.DeepEqual(server.Server.Ports, []int{80, 443}) {
+		t.Errorf("got %+v", server)
+	}
+
+	if err := config.Config.Update(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Config.Get(); got != nil {
+		t.Errorf("empty: got %#v", got)
+	}
+	if err := config.Config.Update([]byte("a: [1, 2")); err == nil {
+		t.Error("expected error on malformed YAML")
+	}
+}
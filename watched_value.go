@@ -0,0 +1,163 @@
+//go:build go1.18
+// +build go1.18
+
+package consul
+
+import (
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerWatchedValue(NewWatchedString)
+	registerWatchedValue(NewWatchedInt)
+	registerWatchedValue(NewWatchedDuration)
+}
+
+// WatchedValue holds a value of type T, which is parsed from the raw value on each update.
+// Zero WatchedValue fields of registered types (WatchedValue[string], WatchedValue[int]
+// and WatchedValue[time.Duration]) are set by PullOrPush, use NewWatchedValue for other types.
+type WatchedValue[T any] struct {
+	parse func(raw []byte) (T, error)
+	v     atomic.Value
+}
+
+// watchedHolder makes any T, including interfaces and nil values, storable in atomic.Value.
+type watchedHolder[T any] struct {
+	v T
+}
+
+// NewWatchedValue returns WatchedValue which parses values with parse.
+func NewWatchedValue[T any](parse func(raw []byte) (T, error)) *WatchedValue[T] {
+	return &WatchedValue[T]{parse: parse}
+}
+
+func NewWatchedString() *WatchedValue[string] {
+	return NewWatchedValue(parseString)
+}
+
+func NewWatchedInt() *WatchedValue[int] {
+	return NewWatchedValue(parseInt)
+}
+
+func NewWatchedDuration() *WatchedValue[time.Duration] {
+	return NewWatchedValue(parseDuration)
+}
+
+func parseString(raw []byte) (string, error) {
+	return string(raw), nil
+}
+
+func parseInt(raw []byte) (int, error) {
+	return strconv.Atoi(string(raw))
+}
+
+func parseDuration(raw []byte) (time.Duration, error) {
+	d, err := timeDuration("", raw)
+	if err != nil {
+		return 0, err
+	}
+	return d.(time.Duration), nil
+}
+
+func (w *WatchedValue[T]) Update(raw []byte) error {
+	if w.parse == nil {
+		return errors.Errorf("parser of %T is not set", w)
+	}
+	return w.update(raw, w.parse)
+}
+
+func (w *WatchedValue[T]) update(raw []byte, parse func(raw []byte) (T, error)) error {
+	v, err := parse(raw)
+	if err != nil {
+		return err
+	}
+	w.v.Store(watchedHolder[T]{v: v})
+	return nil
+}
+
+// Get returns the current value or zero value of T before the first update.
+func (w *WatchedValue[T]) Get() T {
+	h, _ := w.v.Load().(watchedHolder[T])
+	return h.v
+}
+
+// registerWatchedValue registers parser and stringifier of WatchedValue[T],
+// which is made by newFn.
+func registerWatchedValue[T any](newFn func() *WatchedValue[T]) {
+	t := reflect.TypeOf(WatchedValue[T]{})
+	RegisterWellKnownType(t, func(_ string, raw []byte) (interface{}, error) {
+		w := newFn()
+		if err := w.Update(raw); err != nil {
+			return nil, err
+		}
+		return *w, nil
+	})
+	stringifiers[t] = func(v reflect.Value, opts tagOpts) (string, error) {
+		w := v.Interface().(WatchedValue[T])
+		return stringifyValue(reflect.ValueOf(w.Get()), opts)
+	}
+}
+
+// String, Duration and Int embed WatchedValue instead of being its aliases:
+// methods can not be declared on an alias of an instantiated generic type,
+// so aliases would lose the String(), Duration() and Int() accessors and a usable zero value.
+// Their accessors have pointer receivers, as copying them races with Update.
+
+// String is WatchedValue[string] which does not need a parser, so its zero value is ready to use.
+type String struct {
+	WatchedValue[string]
+}
+
+func (s *String) Update(raw []byte) error {
+	return s.update(raw, parseString)
+}
+
+func (s *String) String() string {
+	return s.Get()
+}
+
+func watchableString(_ string, raw []byte) (interface{}, error) {
+	s := String{}
+	return s, s.Update(raw)
+}
+
+// Duration is WatchedValue[time.Duration] which does not need a parser, so its zero value is ready to use.
+type Duration struct {
+	WatchedValue[time.Duration]
+}
+
+func (d *Duration) Update(raw []byte) error {
+	return d.update(raw, parseDuration)
+}
+
+func (d *Duration) Duration() time.Duration {
+	return d.Get()
+}
+
+func watchableDuration(_ string, raw []byte) (interface{}, error) {
+	d := Duration{}
+	return d, d.Update(raw)
+}
+
+// Int is WatchedValue[int] which does not need a parser, so its zero value is ready to use.
+type Int struct {
+	WatchedValue[int]
+}
+
+func (d *Int) Update(raw []byte) error {
+	return d.update(raw, parseInt)
+}
+
+func (d *Int) Int() int {
+	return d.Get()
+}
+
+func watchableInt(_ string, raw []byte) (interface{}, error) {
+	d := Int{}
+	return d, d.Update(raw)
+}
@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+package consul
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWatchedValue(t *testing.T) {
+	type testStruct struct {
+		Name    WatchedValue[string]        `consul:"default:api"`
+		Port    WatchedValue[int]           `consul:"default:8080"`
+		Timeout WatchedValue[time.Duration] `consul:"default:5s"`
+		Ratio   WatchedValue[float64]
+	}
+	kv := testKV{"service/ratio": []byte("0.5")}
+	c, err := NewClient(SetKV(kv), DisableWatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testStruct{
+		Ratio: *NewWatchedValue(func(raw []byte) (float64, error) {
+			return strconv.ParseFloat(string(raw), 64)
+		}),
+	}
+	if err := c.PullOrPush("service", &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Name.Get() != "api" || config.Port.Get() != 8080 || config.Timeout.Get() != 5*time.Second || config.Ratio.Get() != 0.5 {
+		t.Errorf("got %q, %d, %v, %v", config.Name.Get(), config.Port.Get(), config.Timeout.Get(), config.Ratio.Get())
+	}
+	if err := config.Port.Update([]byte("http")); err == nil {
+		t.Error("expected error on invalid int")
+	}
+	if config.Port.Get() != 8080 {
+		t.Errorf("value is changed after invalid update: %d", config.Port.Get())
+	}
+	marshaled, err := MarshalConsul("service", &testStruct{Name: config.Name, Timeout: config.Timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marshaled["service/name"] != "api" || marshaled["service/timeout"] != "5s" {
+		t.Errorf("got %v", marshaled)
+	}
+
+	if err := (&WatchedValue[uint8]{}).Update([]byte("1")); err == nil {
+		t.Error("expected error for WatchedValue without parser")
+	}
+}
+
+func TestWatchedValue_Wrappers(t *testing.T) {
+	var name String
+	var timeout Duration
+	var port Int
+	for value, target := range map[string]Updatable{"api": &name, "5s": &timeout, "8080": &port} {
+		if err := target.Update([]byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if name.Get() != "api" || timeout.Get() != 5*time.Second || port.Get() != 8080 {
+		t.Errorf("got %q, %v, %d", name.Get(), timeout.Get(), port.Get())
+	}
+	if name.String() != "api" || timeout.Duration() != 5*time.Second || port.Int() != 8080 {
+		t.Errorf("got %q, %v, %d", name.String(), timeout.Duration(), port.Int())
+	}
+	if err := port.Update([]byte("http")); err == nil || port.Int() != 8080 {
+		t.Errorf("expected error keeping the value, got %v, %d", err, port.Int())
+	}
+}